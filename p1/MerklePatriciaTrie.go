@@ -2,6 +2,7 @@ package p1
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"golang.org/x/crypto/sha3"
@@ -24,7 +25,7 @@ type Node struct {
 
 // MerklePatriciaTrie contains information about the MPT
 type MerklePatriciaTrie struct {
-	db     map[string]Node
+	db     NodeStore
 	Root   string  `json:"root"`
 	Values ValueDb `json:"valueDb"`
 }
@@ -43,7 +44,7 @@ func (mpt *MerklePatriciaTrie) Get(key string) (string, error) {
 		return "", nil
 	}
 	// Uninitialized Root
-	if mpt.Root == "" || mpt.db == nil || mpt.db[mpt.Root].nodeType == 0 {
+	if mpt.Root == "" || mpt.db == nil || mpt.getNode(mpt.Root).nodeType == 0 {
 		return "", errors.New("uninitialized trie")
 	}
 	// recursively find item
@@ -53,32 +54,50 @@ func (mpt *MerklePatriciaTrie) Get(key string) (string, error) {
 // recurseGet is a recursive helper for Get to hunt for the given key.
 // It returns the found value of "" if not found.
 func (mpt *MerklePatriciaTrie) recurseGet(hexKey []uint8, currHash string) string {
-	currNode := mpt.db[currHash]
-	if currNode.nodeType == 2 { // leaf or ext
-		currDecPrefix := compactDecode(currNode.flagValue.encodedPrefix)
-		increment := similar(currDecPrefix, hexKey)
-		if increment != len(currDecPrefix) {
-			return ""
+	currNode := mpt.getNode(currHash)
+	nextHash, rest, value := currNode.step(hexKey)
+	if nextHash == "" {
+		return value
+	}
+	return mpt.recurseGet(rest, nextHash)
+}
+
+// step follows hexKey one node down from node. If the path continues, it returns the hash of the next node
+// and the remaining key. Otherwise it returns the value stored for hexKey, which is "" if the key is absent.
+func (node *Node) step(hexKey []uint8) (string, []uint8, string) {
+	if node.nodeType == 1 { // branch
+		if len(hexKey) == 0 {
+			return "", nil, node.branchValue[16]
 		}
-		if isExtNode(currNode.flagValue.encodedPrefix) { // ext
-			return mpt.recurseGet(hexKey[increment:], currNode.flagValue.value)
-		} else { // leaf
-			return currNode.flagValue.value
+		return node.branchValue[hexKey[0]], hexKey[1:], ""
+	} else if node.nodeType == 2 { // leaf or ext
+		decodedPrefix := compactDecode(node.flagValue.encodedPrefix)
+		same := similar(decodedPrefix, hexKey)
+		if same != len(decodedPrefix) {
+			return "", nil, ""
 		}
-	} else if currNode.nodeType == 1 { // branch
-		if len(hexKey) == 0 {
-			return currNode.branchValue[16]
+		if isExtNode(node.flagValue.encodedPrefix) { // ext
+			return node.flagValue.value, hexKey[same:], ""
+		} else if same == len(hexKey) { // leaf
+			return "", nil, node.flagValue.value
 		}
-		for _, v := range currNode.branchValue[:16] {
+	}
+	return "", nil, ""
+}
+
+// children returns the hashes of the nodes node points to.
+func (node *Node) children() []string {
+	var hashes []string
+	if node.nodeType == 1 { // branch
+		for _, v := range node.branchValue[:16] {
 			if v != "" {
-				result := mpt.recurseGet(hexKey[1:], v)
-				if result != "" {
-					return result
-				}
+				hashes = append(hashes, v)
 			}
 		}
+	} else if node.nodeType == 2 && isExtNode(node.flagValue.encodedPrefix) { // ext
+		hashes = append(hashes, node.flagValue.value)
 	}
-	return ""
+	return hashes
 }
 
 // Insert finds the correct location in the trie and inserts the value.
@@ -90,31 +109,24 @@ func (mpt *MerklePatriciaTrie) Insert(key string, newValue string) {
 	// If this trie has no Root and is new
 	hexKey := asciiToHexArray([]uint8(key))
 	// If unitialied Root, initialize it
-	if mpt.Root == "" || mpt.db == nil || mpt.db[mpt.Root].nodeType == 0 {
+	if mpt.Root == "" || mpt.db == nil || mpt.getNode(mpt.Root).nodeType == 0 {
 		node := Node{2, [17]string{}, FlagValue{compactEncode(append(hexKey, 16)), newValue}}
 		hash := node.hashNode()
-		mpt.db = make(map[string]Node)
+		if mpt.db == nil {
+			mpt.db = NewMapStore()
+		}
 		mpt.Values.Db = make(map[string]string)
-		mpt.db[hash] = node
+		mpt.db.Put(hash, node)
 		mpt.Values.Db[key] = newValue
-		mpt.Root = hash
+		mpt.setRoot(hash)
 		return
 	}
 	// Recursively find correct slot to insert into
 	currHash := mpt.Root
-	mpt.Root = mpt.recurseInsert(currHash, hexKey, newValue)
+	mpt.setRoot(mpt.recurseInsert(currHash, hexKey, newValue))
 	mpt.Values.Db[key] = newValue
 }
 
-// refreshHash updates the old hash with the new hash.
-// It returns the new hash value.
-func (mpt *MerklePatriciaTrie) refreshHash(oldHash string, newNode Node) string {
-	newHash := newNode.hashNode()
-	delete(mpt.db, oldHash)
-	mpt.db[newHash] = newNode
-	return newHash
-}
-
 // similar finds the number of similar items from the beginning of each uint8 array.
 // It returns the number continual similarities between the two arrays.
 func similar(arr1 []uint8, arr2 []uint8) int {
@@ -130,13 +142,14 @@ func similar(arr1 []uint8, arr2 []uint8) int {
 }
 
 // recurseInsert is a helper function for Insert to help find the location they key should be inserted
-// and rehash up the trie. It returns the highest level hash in the current recursive step.
+// and rehash up the trie. Replaced nodes are left in the store, as identical subtrees and snapshots may still refer
+// to them. It returns the highest level hash in the current recursive step.
 func (mpt *MerklePatriciaTrie) recurseInsert(currHash string, currHexKey []uint8, value string) string {
-	currNode := mpt.db[currHash]
+	currNode := mpt.getNode(currHash)
 	if currNode.nodeType == 1 { // Case 1: Current node is a branch
 		if len(currHexKey) == 0 { // Case 1a: Leaf value should be inserted to branch
 			currNode.branchValue[16] = value
-			return mpt.refreshHash(currHash, currNode)
+			return mpt.putNode(currNode)
 		} else {
 			nextHash := currNode.branchValue[currHexKey[0]]
 			var hash = ""
@@ -144,256 +157,69 @@ func (mpt *MerklePatriciaTrie) recurseInsert(currHash string, currHexKey []uint8
 				// Create leaf
 				node := Node{2, [17]string{}, FlagValue{compactEncode(append(currHexKey[1:], 16)), value}}
 				hash = node.hashNode()
-				mpt.db[hash] = node
+				mpt.db.Put(hash, node)
 			} else { // Case 1c: Curr is branch and array pos is full
 				// Recursive call, get next newHash (should be extension or branch)
 				hash = mpt.recurseInsert(nextHash, currHexKey[1:], value)
 			}
 			currNode.branchValue[currHexKey[0]] = hash
 			// Rehash the current node
-			return mpt.refreshHash(currHash, currNode)
+			return mpt.putNode(currNode)
 		}
 	} else if currNode.nodeType == 2 { // Case 2: Current is a extension or leaf
 		decodedPrefix := compactDecode(currNode.flagValue.encodedPrefix)
 		same := similar(decodedPrefix, currHexKey)
-		if isExtNode(currNode.flagValue.encodedPrefix) { // Case 2a: Current is extension
-			if same > 0 {
-				if same == len(decodedPrefix) { // Case 2aa: ext matches beginning of key. recurse further
-					newNextHash := mpt.recurseInsert(currNode.flagValue.value, currHexKey[len(currNode.flagValue.encodedPrefix):], value)
-					// newNextHash should ALWAYS refer to a branch node
-					currNode.flagValue.value = newNextHash
-					return mpt.refreshHash(currHash, currNode)
-				} else if same == len(decodedPrefix)-1 { // Case 2ab: ext~> => ext->branch->leaf,~>
-					// Create new leaf
-					node := Node{2, [17]string{}, FlagValue{compactEncode(append(currHexKey[same+1:], 16)), value}}
-					hash := node.hashNode()
-					mpt.db[hash] = node
-					// Create new branch
-					branchNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-					branchNode.branchValue[decodedPrefix[same]] = currNode.flagValue.value
-					branchNode.branchValue[currHexKey[same]] = hash
-					branchHash := branchNode.hashNode()
-					mpt.db[branchHash] = branchNode
-					// Edit current extension
-					currNode.flagValue.encodedPrefix = compactEncode(decodedPrefix[:same])
-					currNode.flagValue.value = branchHash
-					return mpt.refreshHash(currHash, currNode)
-				} else if len(currHexKey) == same {
-					// Create new extension
-					// currNode.flagValue.value should ONLY be a branch node
-					extNode := Node{2, [17]string{}, FlagValue{compactEncode(decodedPrefix[same+1:]), currNode.flagValue.value}}
-					extHash := extNode.hashNode()
-					delete(mpt.db, currHash)
-					mpt.db[extHash] = extNode
-					// Create new branch
-					branchNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-					branchNode.branchValue[decodedPrefix[same]] = extHash
-					branchNode.branchValue[16] = value
-					branchHash := branchNode.hashNode()
-					mpt.db[branchHash] = branchNode
-					// Edit current extension
-					currNode.flagValue.encodedPrefix = compactEncode(decodedPrefix[:same])
-					currNode.flagValue.value = branchHash
-					newCurrHash := currNode.hashNode()
-					mpt.db[newCurrHash] = currNode
-					return newCurrHash
-				} else {
-					// Create new extension
-					// currNode.flagValue.value should ONLY be a branch node
-					extNode := Node{2, [17]string{}, FlagValue{compactEncode(decodedPrefix[same+1:]), currNode.flagValue.value}}
-					extHash := extNode.hashNode()
-					delete(mpt.db, currHash)
-					mpt.db[extHash] = extNode
-					// Create new leaf
-					node := Node{2, [17]string{}, FlagValue{compactEncode(append(currHexKey[same+1:], 16)), value}}
-					hash := node.hashNode()
-					mpt.db[hash] = node
-					// Create new branch
-					branchNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-					branchNode.branchValue[decodedPrefix[same]] = extHash
-					branchNode.branchValue[currHexKey[same]] = hash
-					branchHash := branchNode.hashNode()
-					mpt.db[branchHash] = branchNode
-					// Edit current extension
-					currNode.flagValue.encodedPrefix = compactEncode(decodedPrefix[:same])
-					currNode.flagValue.value = branchHash
-					newCurrHash := currNode.hashNode()
-					mpt.db[newCurrHash] = currNode
-					return newCurrHash
-				}
+		isExt := isExtNode(currNode.flagValue.encodedPrefix)
+		if isExt && same == len(decodedPrefix) { // Case 2a: ext matches beginning of key. recurse further
+			newNextHash := mpt.recurseInsert(currNode.flagValue.value, currHexKey[same:], value)
+			// newNextHash should ALWAYS refer to a branch node
+			currNode.flagValue.value = newNextHash
+			return mpt.putNode(currNode)
+		}
+		if !isExt && same == len(decodedPrefix) && same == len(currHexKey) { // Case 2b: Leaf value will be replaced
+			currNode.flagValue.value = value
+			return mpt.putNode(currNode)
+		}
+		// Case 2c: The paths diverge after the shared nibbles, so a new branch is placed at the divergence point
+		newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
+		// Move the current node below the branch
+		if isExt {
+			// decodedPrefix is longer than same here, so the ext keeps pointing to its branch
+			if len(decodedPrefix) == same+1 {
+				newBNode.branchValue[decodedPrefix[same]] = currNode.flagValue.value
 			} else {
-				if len(currHexKey) == 0 {
-					// Create new branch
-					newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-					newBNode.branchValue[16] = value
-					branchPos := decodedPrefix[0]
-					if len(decodedPrefix) <= 1 { // Should be at least 1
-						// If ext prefix length is 1, then remove the ext
-						delete(mpt.db, currHash)
-						newBNode.branchValue[branchPos] = currNode.flagValue.value
-						// rehash branch
-						bHash := newBNode.hashNode()
-						mpt.db[bHash] = newBNode
-						return bHash
-					} else {
-						// If ext prefix length is more than 1, then modify the ext
-						currNode.flagValue.encodedPrefix = compactEncode(decodedPrefix[1:])
-						newHash := mpt.refreshHash(currHash, currNode)
-						newBNode.branchValue[branchPos] = newHash
-						// rehash branch
-						bHash := newBNode.hashNode()
-						mpt.db[bHash] = newBNode
-						return bHash
-					}
-				} else {
-					// We know len(currHexKey) > 0 and same == 0 at this point
-					// Create new leaf
-					node := Node{2, [17]string{}, FlagValue{compactEncode(append(currHexKey[1:], 16)), value}}
-					hash := node.hashNode()
-					mpt.db[hash] = node
-					// Create new branch
-					newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-					newBNode.branchValue[currHexKey[0]] = hash
-					branchPos := decodedPrefix[0]
-					if len(decodedPrefix) <= 1 {
-						// If curr ext length is 1, then remove it.
-						delete(mpt.db, currHash)
-						newBNode.branchValue[branchPos] = currNode.flagValue.value
-						// rehash branch node
-						bHash := newBNode.hashNode()
-						mpt.db[bHash] = newBNode
-						return bHash
-					} else {
-						// If curr ext length is greater than 1, then edit the ext
-						currNode.flagValue.encodedPrefix = compactEncode(decodedPrefix[1:])
-						newHash := mpt.refreshHash(currHash, currNode)
-						newBNode.branchValue[branchPos] = newHash
-						// rehash the branch node
-						bHash := newBNode.hashNode()
-						mpt.db[bHash] = newBNode
-						return bHash
-					}
-				}
-			}
-		} else { // Case 2b: Current is leaf
-			// Case 2ba: Leaf value will be replaced
-			if same == len(currHexKey) && same == len(decodedPrefix) {
-				currNode.flagValue.value = value
-				return mpt.refreshHash(currHash, currNode)
-			} else if len(currHexKey) == 0 {
-				// Create new branch
-				newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-				newBNode.branchValue[16] = value
-				//
-				branchPos := decodedPrefix[0]
-				currNode.flagValue.encodedPrefix = compactEncode(append(decodedPrefix[1:], 16))
-				newHash := mpt.refreshHash(currHash, currNode)
-				newBNode.branchValue[branchPos] = newHash
-				//
-				bHash := newBNode.hashNode()
-				mpt.db[bHash] = newBNode
-				return bHash
-			} else if len(decodedPrefix) == 0 {
-				// Create new leaf
-				node := Node{2, [17]string{}, FlagValue{compactEncode(append(currHexKey[1:], 16)), value}}
-				hash := node.hashNode()
-				mpt.db[hash] = node
-				// Create new branch
-				newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-				newBNode.branchValue[16] = currNode.flagValue.value
-				delete(mpt.db, currHash)
-				newBNode.branchValue[currHexKey[0]] = hash
-				//
-				bHash := newBNode.hashNode()
-				mpt.db[bHash] = newBNode
-				return bHash
-			} else if len(decodedPrefix) == same {
-				// Create new branch
-				newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-				newBNode.branchValue[16] = currNode.flagValue.value
-				//
-				branchPos := currHexKey[same]
-				currNode.flagValue.encodedPrefix = compactEncode(append(currHexKey[same+1:], 16))
-				currNode.flagValue.value = value
-				newHash := mpt.refreshHash(currHash, currNode)
-				newBNode.branchValue[branchPos] = newHash
-				//
-				bHash := newBNode.hashNode()
-				mpt.db[bHash] = newBNode
-				// Create new extension
-				extNode := Node{2, [17]string{}, FlagValue{compactEncode(currHexKey[:same]), bHash}}
-				extHash := extNode.hashNode()
-				mpt.db[extHash] = extNode
-				return extHash
-			} else if len(currHexKey) == same {
-				// Create new branch
-				newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-				newBNode.branchValue[16] = value
-				//
-				branchPos := decodedPrefix[same]
-				currNode.flagValue.encodedPrefix = compactEncode(append(decodedPrefix[same+1:], 16))
-				newHash := mpt.refreshHash(currHash, currNode)
-				newBNode.branchValue[branchPos] = newHash
-				//
-				bHash := newBNode.hashNode()
-				mpt.db[bHash] = newBNode
-				// Create new extension
-				extNode := Node{2, [17]string{}, FlagValue{compactEncode(currHexKey[:same]), bHash}}
-				extHash := extNode.hashNode()
-				mpt.db[extHash] = extNode
-				return extHash
-			} else if same > 0 {
-				// Case 2bb: Current is leaf and the currNode path overlaps with the insert path.
-				//           This means that we will use an extension.
-				// Create new leaf
-				node := Node{2, [17]string{}, FlagValue{compactEncode(append(currHexKey[same+1:], 16)), value}}
-				hash := node.hashNode()
-				mpt.db[hash] = node
-				// Create new branch
-				newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-				newBNode.branchValue[currHexKey[same]] = hash
-				//
-				branchPos := decodedPrefix[same]
-				currNode.flagValue.encodedPrefix = compactEncode(append(decodedPrefix[same+1:], 16))
-				newHash := mpt.refreshHash(currHash, currNode)
-				newBNode.branchValue[branchPos] = newHash
-				//
-				bHash := newBNode.hashNode()
-				mpt.db[bHash] = newBNode
-				// Create new extension
-				extNode := Node{2, [17]string{}, FlagValue{compactEncode(currHexKey[:same]), bHash}}
+				extNode := Node{2, [17]string{}, FlagValue{compactEncode(decodedPrefix[same+1:]), currNode.flagValue.value}}
 				extHash := extNode.hashNode()
-				mpt.db[extHash] = extNode
-				return extHash
-			} else {
-				// Case 2bc: Current is leaf and there is no overlap in path. So we will not add an extension.
-				if len(currHexKey) == 0 {
-					currNode.flagValue.value = value
-					return mpt.refreshHash(currHash, currNode)
-				}
-				// Create new leaf
-				node := Node{2, [17]string{}, FlagValue{compactEncode(append(currHexKey[1:], 16)), value}}
-				hash := node.hashNode()
-				mpt.db[hash] = node
-				// Create new branch
-				newBNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
-				newBNode.branchValue[currHexKey[same]] = hash
-				//
-				if len(decodedPrefix) == 0 {
-					newBNode.branchValue[16] = currNode.flagValue.value
-					delete(mpt.db, currHash)
-				} else {
-					branchPos := decodedPrefix[same]
-					currNode.flagValue.encodedPrefix = compactEncode(append(decodedPrefix[1:], 16))
-					newHash := mpt.refreshHash(currHash, currNode)
-					newBNode.branchValue[branchPos] = newHash
-				}
-				//
-				bHash := newBNode.hashNode()
-				mpt.db[bHash] = newBNode
-				return bHash
+				mpt.db.Put(extHash, extNode)
+				newBNode.branchValue[decodedPrefix[same]] = extHash
 			}
+		} else if len(decodedPrefix) == same {
+			newBNode.branchValue[16] = currNode.flagValue.value
+		} else {
+			leafNode := Node{2, [17]string{}, FlagValue{compactEncode(append(decodedPrefix[same+1:], 16)), currNode.flagValue.value}}
+			leafHash := leafNode.hashNode()
+			mpt.db.Put(leafHash, leafNode)
+			newBNode.branchValue[decodedPrefix[same]] = leafHash
+		}
+		// Add the new value below the branch
+		if len(currHexKey) == same {
+			newBNode.branchValue[16] = value
+		} else {
+			leafNode := Node{2, [17]string{}, FlagValue{compactEncode(append(currHexKey[same+1:], 16)), value}}
+			leafHash := leafNode.hashNode()
+			mpt.db.Put(leafHash, leafNode)
+			newBNode.branchValue[currHexKey[same]] = leafHash
 		}
+		bHash := newBNode.hashNode()
+		mpt.db.Put(bHash, newBNode)
+		if same == 0 {
+			return bHash
+		}
+		// Create new extension for the shared nibbles
+		extNode := Node{2, [17]string{}, FlagValue{compactEncode(currHexKey[:same]), bHash}}
+		extHash := extNode.hashNode()
+		mpt.db.Put(extHash, extNode)
+		return extHash
 	}
 	return "" // This should NEVER happen
 }
@@ -408,164 +234,107 @@ func (mpt *MerklePatriciaTrie) Delete(key string) (string, error) {
 
 	// If this trie has no Root and is new
 	hexKey := asciiToHexArray([]uint8(key))
-	if mpt.Root == "" || mpt.db == nil || mpt.db[mpt.Root].nodeType == 0 {
+	if mpt.Root == "" || mpt.db == nil || mpt.getNode(mpt.Root).nodeType == 0 {
 		return "", errors.New("uninitialized trie")
 	}
 
-	item, nodeHash, remove := mpt.recurseDelete(hexKey, mpt.Root)
-	if remove {
-		mpt.Root = ""
-		mpt.db = nil
-	} else {
-		mpt.Root = nodeHash
+	item, node := mpt.recurseDelete(hexKey, mpt.Root)
+	if item == "" {
+		return "", nil
 	}
+	mpt.setRoot(mpt.putNonEmpty(node))
 	delete(mpt.Values.Db, key)
 	return item, nil
 }
 
-// recursiveDelete is the helper function for Delete.
-// The function recursively searches and updates the trie hashes for an item. It returns the value that was deleted,
-// the highest level hash in the recursive step, and whether the value should be removed. If the value should not
-// be remove then just rehash.
-func (mpt *MerklePatriciaTrie) recurseDelete(hexKey []uint8, currHash string) (string, string, bool) {
-	currNode := mpt.db[currHash]
+// recurseDelete is the helper function for Delete.
+// The function recursively searches for hexKey below the node under currHash and rebuilds the nodes on the way
+// back up, collapsing branches that are left with a single entry. It returns the value that was deleted, or "" if
+// the key was not found, and the rebuilt node, which is an empty Node if nothing is left below it.
+// The rebuilt node is not stored yet, as a collapsed node is merged into the ext above it: storing it would leave
+// a node in the store that nothing points to.
+func (mpt *MerklePatriciaTrie) recurseDelete(hexKey []uint8, currHash string) (string, Node) {
+	currNode := mpt.getNode(currHash)
 	if currNode.nodeType == 1 { // branch
+		var item string
 		if len(hexKey) == 0 {
-			val := currNode.branchValue[16]
+			item = currNode.branchValue[16]
 			currNode.branchValue[16] = ""
-			filled := 0
-			var idx = -1
-			var lastHash = ""
-			for i, v := range currNode.branchValue[:len(currNode.branchValue)-1] {
-				if v != "" {
-					filled++
-					lastHash = v
-					idx = i
-				}
+		} else if currNode.branchValue[hexKey[0]] != "" {
+			var node Node
+			item, node = mpt.recurseDelete(hexKey[1:], currNode.branchValue[hexKey[0]])
+			if item != "" {
+				currNode.branchValue[hexKey[0]] = mpt.putNonEmpty(node)
 			}
-			if filled == 1 {
-				lastNode := mpt.db[lastHash]
-				if lastNode.nodeType == 2 && !isExtNode(lastNode.flagValue.encodedPrefix) {
-					// leaf
-					lastNode.flagValue.encodedPrefix = compactEncode(append([]uint8{uint8(idx)}, append(compactDecode(lastNode.flagValue.encodedPrefix), 16)...))
-				} else {
-					lastNode.flagValue.encodedPrefix = compactEncode(append([]uint8{uint8(idx)}, compactDecode(lastNode.flagValue.encodedPrefix)...))
-				}
-				delete(mpt.db, currHash)
-				return val, mpt.refreshHash(lastHash, lastNode), false
-			} else {
-				return val, mpt.refreshHash(currHash, currNode), false
-			}
-		}
-		if currNode.branchValue[hexKey[0]] == "" {
-			return "", currHash, false
 		}
-		item, nodeHash, remove := mpt.recurseDelete(hexKey[1:], currNode.branchValue[hexKey[0]])
 		if item == "" {
-			return "", currHash, false
+			return "", currNode
 		}
-		node := mpt.db[nodeHash]
-		if node.nodeType == 2 {
-			if isExtNode(node.flagValue.encodedPrefix) || !remove {
-				currNode.branchValue[hexKey[0]] = node.hashNode()
-				return item, mpt.refreshHash(currHash, currNode), false
-			} else {
-				filled := 0
-				var lastHash = ""
-				var idx = -1
-				for i, v := range currNode.branchValue[:len(currNode.branchValue)-1] {
-					if v != "" {
-						filled++
-						if i != int(hexKey[0]) {
-							lastHash = v
-							idx = i
-						}
-					}
-				}
-				if filled > 2 {
-					currNode.branchValue[hexKey[0]] = ""
-					return item, mpt.refreshHash(currHash, currNode), false
-				} else if currNode.branchValue[16] != "" {
-					node := Node{2, [17]string{}, FlagValue{compactEncode(append([]uint8{uint8(idx)}, 16)), currNode.branchValue[16]}}
-					hash := node.hashNode()
-					mpt.db[hash] = node
-					return item, hash, false
-				} else if filled > 1 {
-					lastNode := mpt.db[lastHash]
-					if lastNode.nodeType == 2 {
-						if !isExtNode(lastNode.flagValue.encodedPrefix) {
-							// leaf
-							lastNode.flagValue.encodedPrefix = compactEncode(append([]uint8{uint8(idx)}, append(compactDecode(lastNode.flagValue.encodedPrefix), 16)...))
-						} else {
-							lastNode.flagValue.encodedPrefix = compactEncode(append([]uint8{uint8(idx)}, compactDecode(lastNode.flagValue.encodedPrefix)...))
-						}
-						delete(mpt.db, currHash)
-						return item, mpt.refreshHash(lastHash, lastNode), false
-					} else if lastNode.nodeType == 1 {
-						// Convert branch to extension
-						currNode.nodeType = 2
-						currNode.flagValue.value = lastHash
-						currNode.branchValue = [17]string{}
-						currNode.flagValue.encodedPrefix = compactEncode([]uint8{uint8(idx)})
-						return item, mpt.refreshHash(currHash, currNode), false
-					}
-				} else {
-					return item, currHash, false
-				}
-			}
-		} else if node.nodeType == 1 {
-			currNode.branchValue[hexKey[0]] = nodeHash
-			return item, mpt.refreshHash(currHash, currNode), false
-		}
-		return item, currHash, false
+		return item, mpt.collapseBranch(currNode)
 	} else if currNode.nodeType == 2 { // leaf or ext
+		decodedPrefix := compactDecode(currNode.flagValue.encodedPrefix)
 		if isExtNode(currNode.flagValue.encodedPrefix) { // ext
-			decodedPrefix := compactDecode(currNode.flagValue.encodedPrefix)
-			if len(hexKey) < len(decodedPrefix) {
-				return "", currHash, false
-			}
-			for i, v := range decodedPrefix {
-				if v != hexKey[i] {
-					return "", currHash, false
-				}
+			if similar(decodedPrefix, hexKey) != len(decodedPrefix) {
+				return "", currNode
 			}
-			item, nodeHash, _ := mpt.recurseDelete(hexKey[len(decodedPrefix):], currNode.flagValue.value)
+			item, node := mpt.recurseDelete(hexKey[len(decodedPrefix):], currNode.flagValue.value)
 			if item == "" {
-				return "", currHash, false
+				return "", currNode
 			}
-			node := mpt.db[nodeHash]
-			if node.nodeType == 2 {
-				if isExtNode(node.flagValue.encodedPrefix) {
-					currNode.flagValue.encodedPrefix = compactEncode(
-						append(decodedPrefix, compactDecode(node.flagValue.encodedPrefix)...))
-					currNode.flagValue.value = node.flagValue.value
-					return item, mpt.refreshHash(currHash, currNode), false
-				} else {
-					node.flagValue.encodedPrefix = compactEncode(
-						append(append(decodedPrefix, compactDecode(node.flagValue.encodedPrefix)...), 16))
-					delete(mpt.db, currHash)
-					mpt.db[node.hashNode()] = node
-					return item, nodeHash, false
-				}
-			} else if node.nodeType == 1 {
-				currNode.flagValue.value = nodeHash
-				return item, mpt.refreshHash(currHash, currNode), false
-			}
-			return item, currHash, false
-		} else { // leaf
-			decodedPrefix := compactDecode(currNode.flagValue.encodedPrefix)
-			if len(hexKey) != len(decodedPrefix) {
-				return "", currHash, false
-			}
-			for i, v := range decodedPrefix {
-				if v != hexKey[i] {
-					return "", currHash, false
-				}
-			}
-			return currNode.flagValue.value, currHash, true
+			// The branch below may have collapsed into a leaf or ext, which is merged into this ext
+			return item, mpt.prependPath(decodedPrefix, node)
 		}
+		// leaf
+		if len(hexKey) != len(decodedPrefix) || similar(decodedPrefix, hexKey) != len(decodedPrefix) {
+			return "", currNode
+		}
+		return currNode.flagValue.value, Node{}
 	}
-	return "", currHash, false
+	return "", currNode
+}
+
+// collapseBranch rebuilds branchNode after one of its entries was removed. A branch needs at least two entries: a
+// branch left with only its value becomes a leaf with an empty path, and a branch left with a single child is
+// merged with that child. It returns the resulting node, which is not stored, or an empty Node if the branch is
+// empty.
+func (mpt *MerklePatriciaTrie) collapseBranch(branchNode Node) Node {
+	entries := 0
+	idx := -1
+	for i, v := range branchNode.branchValue {
+		if v != "" {
+			entries++
+			idx = i
+		}
+	}
+	if entries == 0 {
+		return Node{}
+	} else if entries > 1 {
+		return branchNode
+	} else if idx == 16 {
+		return Node{2, [17]string{}, FlagValue{compactEncode([]uint8{16}), branchNode.branchValue[16]}}
+	}
+	return mpt.prependPath([]uint8{uint8(idx)}, mpt.getNode(branchNode.branchValue[idx]))
+}
+
+// prependPath returns a node that reaches node through the nibbles of path. A leaf or ext is rebuilt with path in
+// front of its own, and a branch is stored and gets a new ext pointing at it. The returned node is not stored.
+func (mpt *MerklePatriciaTrie) prependPath(path []uint8, node Node) Node {
+	if node.nodeType != 2 {
+		return Node{2, [17]string{}, FlagValue{compactEncode(joinNibbles(nil, path)), mpt.putNode(node)}}
+	}
+	merged := joinNibbles(path, compactDecode(node.flagValue.encodedPrefix))
+	if !isExtNode(node.flagValue.encodedPrefix) {
+		merged = append(merged, 16)
+	}
+	return Node{2, [17]string{}, FlagValue{compactEncode(merged), node.flagValue.value}}
+}
+
+// putNonEmpty stores node like putNode. It returns "" for an empty Node, which is not stored.
+func (mpt *MerklePatriciaTrie) putNonEmpty(node Node) string {
+	if node.nodeType == 0 {
+		return ""
+	}
+	return mpt.putNode(node)
 }
 
 // compactEncode encodes an hexArray to an ASCII array with the specified attributes in the link below.
@@ -633,25 +402,11 @@ func testCompactEncode() {
 	fmt.Println(reflect.DeepEqual(compactDecode(compactEncode([]uint8{15, 1, 12, 11, 8, 16})), []uint8{15, 1, 12, 11, 8}))
 }
 
-// hashNode hashes a node with HashStart and HashEnd at either end for clarity.
-// This function returns the hash string.
-// TODO: Remove HashStart and HashEnd
+// hashNode hashes the canonical encoding of a node as described in encoding.go.
+// This function returns the hash as a hex string.
 func (node *Node) hashNode() string {
-	var str string
-	switch node.nodeType {
-	case 0:
-		str = ""
-	case 1:
-		str = "branch_"
-		for _, v := range node.branchValue {
-			str += v
-		}
-	case 2:
-		str = node.flagValue.value
-	}
-
-	sum := sha3.Sum256([]byte(str))
-	return "HashStart_" + hex.EncodeToString(sum[:]) + "_HashEnd"
+	sum := sha3.Sum256(node.encode())
+	return hex.EncodeToString(sum[:])
 }
 
 // String returns the string representation of the Node.
@@ -685,19 +440,98 @@ func nodeToString(node Node) string {
 
 // Initial functions like a simple constructor for the MerklePatriciaTrie.
 func (mpt *MerklePatriciaTrie) Initial() {
-	mpt.db = make(map[string]Node)
+	mpt.db = NewMapStore()
+}
+
+// InitialStore functions like Initial but keeps the nodes of the trie in the given store.
+func (mpt *MerklePatriciaTrie) InitialStore(store NodeStore) {
+	mpt.db = store
+}
+
+// setRoot makes root the Root of the trie. If the nodes are kept in a RefCountStore, the new root is retained
+// and the old root is released, which frees every node that is no longer in use.
+func (mpt *MerklePatriciaTrie) setRoot(root string) {
+	if refStore, ok := mpt.db.(*RefCountStore); ok && root != mpt.Root {
+		if root != "" {
+			refStore.Retain(root)
+		}
+		if mpt.Root != "" {
+			refStore.Release(mpt.Root)
+		}
+	}
+	mpt.Root = root
+}
+
+// getNode returns the node stored under hash. A Null node is returned if the hash is unknown.
+func (mpt *MerklePatriciaTrie) getNode(hash string) Node {
+	node, _ := mpt.db.Get(hash)
+	return node
+}
+
+// UnmarshalJSON decodes a trie from JSON. Only Root and Values.Db are serialized, so the node database is
+// rebuilt by inserting every value again. An error is returned if the rebuilt root does not match Root.
+func (mpt *MerklePatriciaTrie) UnmarshalJSON(data []byte) error {
+	type jsonTrie MerklePatriciaTrie
+	var decoded jsonTrie
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	rebuilt := MerklePatriciaTrie{}
+	rebuilt.Initial()
+	for k, v := range decoded.Values.Db {
+		rebuilt.Insert(k, v)
+	}
+	if rebuilt.Root != decoded.Root {
+		return fmt.Errorf("root mismatch: expected %s but values hash to %s", decoded.Root, rebuilt.Root)
+	}
+	*mpt = rebuilt
+	return nil
 }
 
-// Clone mpt (make deep copy)
+// Clone mpt (make deep copy). The nodes reachable from Root are copied into a new in-memory store, so the
+// clone keeps the same Root without inserting the values again and shares nothing with mpt.
 func (mpt *MerklePatriciaTrie) Clone() MerklePatriciaTrie {
 	mpt2 := MerklePatriciaTrie{}
 	mpt2.Initial()
-	for k, v := range mpt2.Values.Db {
-		mpt2.Insert(k, v)
+	mpt2.Values.Db = copyValues(mpt.Values.Db)
+	if mpt.Root == "" || mpt.db == nil {
+		return mpt2
 	}
+	queue := []string{mpt.Root}
+	for len(queue) != 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if _, ok := mpt2.db.Get(hash); ok {
+			continue
+		}
+		node := mpt.getNode(hash)
+		mpt2.db.Put(hash, node)
+		queue = append(queue, node.children()...)
+	}
+	mpt2.Root = mpt.Root
 	return mpt2
 }
 
+// CloneShared makes a cheap copy of mpt that shares its node store. Updates only ever add nodes to the store,
+// so changes made to either trie afterwards are not seen by the other. Only Values.Db is copied.
+func (mpt *MerklePatriciaTrie) CloneShared() MerklePatriciaTrie {
+	mpt2 := MerklePatriciaTrie{db: mpt.db, Values: ValueDb{copyValues(mpt.Values.Db)}}
+	mpt2.setRoot(mpt.Root)
+	return mpt2
+}
+
+// copyValues returns a copy of the values map of a trie.
+func copyValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
+
 // isExtNode tests if the encoded array is an extension node. The boolean evaluated is returned.
 func isExtNode(encodedArr []uint8) bool {
 	return encodedArr[0]/16 < 2
@@ -711,42 +545,39 @@ func TestCompact() {
 // String converts a MerklePatriciaTrie to a string representation. This string is returned.
 func (mpt *MerklePatriciaTrie) String() string {
 	content := fmt.Sprintf("ROOT=%s\n", mpt.Root)
-	for hash := range mpt.db {
-		content += fmt.Sprintf("%s: %s\n", hash, nodeToString(mpt.db[hash]))
+	if mpt.Root == "" || mpt.db == nil {
+		return content
+	}
+	// The store may be shared or on disk, so only the nodes reachable from Root are listed
+	queue := []string{mpt.Root}
+	for len(queue) != 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		node := mpt.getNode(hash)
+		content += fmt.Sprintf("%s: %s\n", hash, nodeToString(node))
+		queue = append(queue, node.children()...)
 	}
 	return content
 }
 
-// OrderNodes orders the nodes in a string representation. The string is returned.
+// OrderNodes orders the nodes in a string representation. Hashes are replaced by the position the node was
+// visited at, so tries with the same shape produce the same string. The string is returned.
 func (mpt *MerklePatriciaTrie) OrderNodes() string {
-	rawContent := mpt.String()
-	content := strings.Split(rawContent, "\n")
-	rootHash := strings.Split(strings.Split(content[0], "HashStart")[1], "HashEnd")[0]
-	queue := []string{rootHash}
+	if mpt.Root == "" || mpt.db == nil {
+		return ""
+	}
+	stack := []string{mpt.Root}
 	i := -1
 	rs := ""
 	curHash := ""
-	for len(queue) != 0 {
-		lastIndex := len(queue) - 1
-		curHash, queue = queue[lastIndex], queue[:lastIndex]
+	for len(stack) != 0 {
+		lastIndex := len(stack) - 1
+		curHash, stack = stack[lastIndex], stack[:lastIndex]
 		i += 1
-		line := ""
-		for _, each := range content {
-			if strings.HasPrefix(each, "HashStart"+curHash+"HashEnd") {
-				line = strings.Split(each, "HashEnd: ")[1]
-				rs += each + "\n"
-				rs = strings.Replace(rs, "HashStart"+curHash+"HashEnd", fmt.Sprintf("Hash%v", i), -1)
-			}
-		}
-		temp2 := strings.Split(line, "HashStart")
-		flag := true
-		for _, each := range temp2 {
-			if flag {
-				flag = false
-				continue
-			}
-			queue = append(queue, strings.Split(each, "HashEnd")[0])
-		}
+		node := mpt.getNode(curHash)
+		rs += curHash + ": " + nodeToString(node) + "\n"
+		rs = strings.Replace(rs, curHash, fmt.Sprintf("Hash%v", i), -1)
+		stack = append(stack, node.children()...)
 	}
 	return rs
 }
@@ -0,0 +1,58 @@
+package p1
+
+import (
+	"fmt"
+	"testing"
+)
+
+// insertKeys returns a new trie holding every key of keys, inserted in order, with the value "v" + key.
+func insertKeys(keys []string) MerklePatriciaTrie {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	for _, k := range keys {
+		mpt.Insert(k, "v"+k)
+	}
+	return mpt
+}
+
+// TestInsertSplitsPaths inserts keys that go through extensions of odd and even length, that end on a branch and
+// that split a leaf, and checks every key can be read back and the root does not depend on the insert order.
+func TestInsertSplitsPaths(t *testing.T) {
+	cases := [][]string{
+		{"aa", "ab", "ac"},
+		{"abc", "abd", "ab"},
+		{"p", "pa", "pab", "pb"},
+		{"hello", "help", "he", "hex", "h"},
+		{"do", "dog", "doge", "horse"},
+	}
+	for _, keys := range cases {
+		mpt := insertKeys(keys)
+		for _, k := range keys {
+			if v, err := mpt.Get(k); err != nil || v != "v"+k {
+				t.Errorf("%v: Get(%q) = %q, %v", keys, k, v, err)
+			}
+		}
+		reversed := make([]string, len(keys))
+		for i, k := range keys {
+			reversed[len(keys)-1-i] = k
+		}
+		if other := insertKeys(reversed); other.Root != mpt.Root {
+			t.Errorf("%v: root %s differs from the root %s of the reversed insert order", keys, mpt.Root,
+				other.Root)
+		}
+	}
+}
+
+// TestInsertReplacesValue checks that inserting an existing key again replaces its value.
+func TestInsertReplacesValue(t *testing.T) {
+	mpt := insertKeys([]string{"ab", "ac"})
+	for i := 0; i < 3; i++ {
+		mpt.Insert("ab", fmt.Sprint(i))
+	}
+	if v, err := mpt.Get("ab"); err != nil || v != "2" {
+		t.Errorf("Get(ab) = %q, %v", v, err)
+	}
+	if v, err := mpt.Get("ac"); err != nil || v != "vac" {
+		t.Errorf("Get(ac) = %q, %v", v, err)
+	}
+}
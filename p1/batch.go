@@ -0,0 +1,117 @@
+package p1
+
+import (
+	"errors"
+	"sort"
+)
+
+// InsertBatch inserts every key and value of batch into the trie. Instead of inserting the keys one by one, the
+// trie is built in a single pass over the sorted keys, so every node is created and hashed only once.
+// The existing values of the trie are included in the build. Empty keys and values are skipped like in Insert.
+func (mpt *MerklePatriciaTrie) InsertBatch(batch map[string]string) {
+	merged := make(map[string]string, len(mpt.Values.Db)+len(batch))
+	if mpt.Root != "" {
+		for k, v := range mpt.Values.Db {
+			merged[k] = v
+		}
+	}
+	for k, v := range batch {
+		if len(k) != 0 && len(v) != 0 {
+			merged[k] = v
+		}
+	}
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = merged[k]
+	}
+	mpt.build(keys, values)
+}
+
+// BuildSorted builds an empty trie from keys in strictly ascending order and their values in one pass.
+// An error is returned if the trie is not empty, the keys are not sorted, or a key or value is empty.
+func (mpt *MerklePatriciaTrie) BuildSorted(keys []string, values []string) error {
+	if mpt.Root != "" {
+		return errors.New("trie is not empty")
+	}
+	if len(keys) != len(values) {
+		return errors.New("keys and values differ in length")
+	}
+	for i, k := range keys {
+		if len(k) == 0 || len(values[i]) == 0 {
+			return errors.New("missing key or value")
+		}
+		if i > 0 && keys[i-1] >= k {
+			return errors.New("keys are not in ascending order")
+		}
+	}
+	mpt.build(keys, values)
+	return nil
+}
+
+// build replaces the contents of the trie with keys, which are sorted, and their values.
+func (mpt *MerklePatriciaTrie) build(keys []string, values []string) {
+	if mpt.db == nil {
+		mpt.db = NewMapStore()
+	}
+	hexKeys := make([][]uint8, len(keys))
+	mpt.Values.Db = make(map[string]string, len(keys))
+	for i, k := range keys {
+		hexKeys[i] = asciiToHexArray([]uint8(k))
+		mpt.Values.Db[k] = values[i]
+	}
+	root := ""
+	if len(keys) > 0 {
+		root = mpt.buildNode(hexKeys, values, 0)
+	}
+	mpt.setRoot(root)
+}
+
+// buildNode builds the subtrie holding hexKeys, which are sorted and share their first depth nibbles.
+// It returns the hash of the highest node of the subtrie.
+func (mpt *MerklePatriciaTrie) buildNode(hexKeys [][]uint8, values []string, depth int) string {
+	if len(hexKeys) == 1 {
+		node := Node{2, [17]string{}, FlagValue{compactEncode(append(joinNibbles(nil, hexKeys[0][depth:]), 16)), values[0]}}
+		return mpt.putNode(node)
+	}
+	// The keys are sorted, so the nibbles shared by the first and the last key are shared by all of them
+	same := similar(hexKeys[0][depth:], hexKeys[len(hexKeys)-1][depth:])
+	bHash := mpt.buildBranch(hexKeys, values, depth+same)
+	if same == 0 {
+		return bHash
+	}
+	node := Node{2, [17]string{}, FlagValue{compactEncode(hexKeys[0][depth : depth+same]), bHash}}
+	return mpt.putNode(node)
+}
+
+// buildBranch builds the branch for hexKeys, which are sorted and share their first depth nibbles.
+// It returns the hash of the branch.
+func (mpt *MerklePatriciaTrie) buildBranch(hexKeys [][]uint8, values []string, depth int) string {
+	branchNode := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
+	if len(hexKeys[0]) == depth {
+		// The key that ends here sorts before every other key
+		branchNode.branchValue[16] = values[0]
+		hexKeys, values = hexKeys[1:], values[1:]
+	}
+	for start := 0; start < len(hexKeys); {
+		nibble := hexKeys[start][depth]
+		end := start + 1
+		for end < len(hexKeys) && hexKeys[end][depth] == nibble {
+			end++
+		}
+		branchNode.branchValue[nibble] = mpt.buildNode(hexKeys[start:end], values[start:end], depth+1)
+		start = end
+	}
+	return mpt.putNode(branchNode)
+}
+
+// putNode hashes node and stores it. It returns the hash of the node.
+func (mpt *MerklePatriciaTrie) putNode(node Node) string {
+	hash := node.hashNode()
+	mpt.db.Put(hash, node)
+	return hash
+}
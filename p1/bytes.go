@@ -0,0 +1,129 @@
+package p1
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"unicode/utf8"
+)
+
+// The trie stores keys and values as Go strings, which may hold any bytes. The functions in this file take and
+// return byte slices for binary keys and values, and encode integers as fixed-width big-endian keys so that
+// numeric keys sort in numeric order and never collide.
+
+// GetBytes finds the value for a binary key. It returns nil if the key is not found. It behaves like Get.
+func (mpt *MerklePatriciaTrie) GetBytes(key []byte) ([]byte, error) {
+	value, err := mpt.Get(string(key))
+	if value == "" {
+		return nil, err
+	}
+	return []byte(value), err
+}
+
+// InsertBytes inserts a binary key and value. It behaves like Insert.
+func (mpt *MerklePatriciaTrie) InsertBytes(key []byte, value []byte) {
+	mpt.Insert(string(key), string(value))
+}
+
+// DeleteBytes removes a binary key. It returns the removed value, or nil if the key is not found. It behaves
+// like Delete.
+func (mpt *MerklePatriciaTrie) DeleteBytes(key []byte) ([]byte, error) {
+	value, err := mpt.Delete(string(key))
+	if value == "" {
+		return nil, err
+	}
+	return []byte(value), err
+}
+
+// Int32Key encodes n as a 4 byte big-endian key. The sign bit is flipped so that negative numbers sort before
+// positive ones.
+func Int32Key(n int32) []byte {
+	return Uint32Key(uint32(n) ^ 1<<31)
+}
+
+// KeyInt32 decodes a key made by Int32Key. An error is returned if the key is not 4 bytes long.
+func KeyInt32(key []byte) (int32, error) {
+	n, err := KeyUint32(key)
+	return int32(n ^ 1<<31), err
+}
+
+// Uint32Key encodes n as a 4 byte big-endian key.
+func Uint32Key(n uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, n)
+	return key
+}
+
+// KeyUint32 decodes a key made by Uint32Key. An error is returned if the key is not 4 bytes long.
+func KeyUint32(key []byte) (uint32, error) {
+	if len(key) != 4 {
+		return 0, errors.New("key is not 4 bytes long")
+	}
+	return binary.BigEndian.Uint32(key), nil
+}
+
+// Uint64Key encodes n as an 8 byte big-endian key.
+func Uint64Key(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key
+}
+
+// KeyUint64 decodes a key made by Uint64Key. An error is returned if the key is not 8 bytes long.
+func KeyUint64(key []byte) (uint64, error) {
+	if len(key) != 8 {
+		return 0, errors.New("key is not 8 bytes long")
+	}
+	return binary.BigEndian.Uint64(key), nil
+}
+
+// valueDbJson is the JSON form of a ValueDb. JSON strings must be valid UTF-8, so entries whose key or value is
+// not are hex encoded into a separate map. Older encodings only hold the first map and still decode.
+type valueDbJson struct {
+	Db    map[string]string `json:"mpt"`
+	HexDb map[string]string `json:"mptHex,omitempty"`
+}
+
+// MarshalJSON encodes the values of the trie. Keys and values that are not valid UTF-8 are hex encoded.
+func (valueDb ValueDb) MarshalJSON() ([]byte, error) {
+	encoded := valueDbJson{}
+	if valueDb.Db != nil {
+		encoded.Db = make(map[string]string, len(valueDb.Db))
+	}
+	for k, v := range valueDb.Db {
+		if utf8.ValidString(k) && utf8.ValidString(v) {
+			encoded.Db[k] = v
+			continue
+		}
+		if encoded.HexDb == nil {
+			encoded.HexDb = make(map[string]string)
+		}
+		encoded.HexDb[hex.EncodeToString([]byte(k))] = hex.EncodeToString([]byte(v))
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes the values of the trie, including the hex encoded entries.
+func (valueDb *ValueDb) UnmarshalJSON(data []byte) error {
+	var decoded valueDbJson
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	for k, v := range decoded.HexDb {
+		key, err := hex.DecodeString(k)
+		if err != nil {
+			return err
+		}
+		value, err := hex.DecodeString(v)
+		if err != nil {
+			return err
+		}
+		if decoded.Db == nil {
+			decoded.Db = make(map[string]string)
+		}
+		decoded.Db[string(key)] = string(value)
+	}
+	valueDb.Db = decoded.Db
+	return nil
+}
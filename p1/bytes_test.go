@@ -0,0 +1,42 @@
+package p1
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestJsonInvalidUtf8 round trips a trie holding keys and values that are not valid UTF-8 through JSON and checks
+// the bytes and the root are unchanged.
+func TestJsonInvalidUtf8(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.InsertBytes([]byte{0xff, 0xfe}, []byte{0xc3, 0x28})
+	mpt.InsertBytes([]byte("plain"), []byte{0x80})
+	mpt.InsertBytes(Uint32Key(7), []byte("seven"))
+	mpt.Insert("text", "ok")
+
+	data, err := json.Marshal(mpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "\ufffd") {
+		t.Errorf("JSON replaced invalid bytes: %s", data)
+	}
+	var decoded MerklePatriciaTrie
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Root != mpt.Root {
+		t.Errorf("decoded root %s, want %s", decoded.Root, mpt.Root)
+	}
+	for k, v := range mpt.Values.Db {
+		if got, err := decoded.GetBytes([]byte(k)); err != nil || !bytes.Equal(got, []byte(v)) {
+			t.Errorf("GetBytes(%x) = %x, %v, want %x", k, got, err, v)
+		}
+	}
+	if len(decoded.Values.Db) != len(mpt.Values.Db) {
+		t.Errorf("decoded %d values, want %d", len(decoded.Values.Db), len(mpt.Values.Db))
+	}
+}
@@ -0,0 +1,101 @@
+package p1
+
+import (
+	"sync"
+)
+
+// ConcurrentTrie wraps a MerklePatriciaTrie so that it can be shared between goroutines. Reads such as Get and
+// the proofs hold a read lock and run in parallel, while updates hold the write lock and run one at a time.
+type ConcurrentTrie struct {
+	trie MerklePatriciaTrie
+	mux  sync.RWMutex
+}
+
+// NewConcurrentTrie wraps mpt. The wrapped trie must not be used directly afterwards.
+func NewConcurrentTrie(mpt MerklePatriciaTrie) *ConcurrentTrie {
+	if mpt.db == nil {
+		mpt.Initial()
+	}
+	return &ConcurrentTrie{trie: mpt}
+}
+
+// Root returns the current root hash of the trie.
+func (ct *ConcurrentTrie) Root() string {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+	return ct.trie.Root
+}
+
+// Get finds the value for key. It behaves like MerklePatriciaTrie.Get.
+func (ct *ConcurrentTrie) Get(key string) (string, error) {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+	return ct.trie.Get(key)
+}
+
+// Prove builds a Proof that key is stored in the trie. It behaves like MerklePatriciaTrie.Prove.
+func (ct *ConcurrentTrie) Prove(key string) (Proof, error) {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+	return ct.trie.Prove(key)
+}
+
+// ProveAbsence builds a Proof that key is not stored in the trie. It behaves like
+// MerklePatriciaTrie.ProveAbsence.
+func (ct *ConcurrentTrie) ProveAbsence(key string) (Proof, error) {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+	return ct.trie.ProveAbsence(key)
+}
+
+// ProveMany builds a MultiProof covering every key in keys. It behaves like MerklePatriciaTrie.ProveMany.
+func (ct *ConcurrentTrie) ProveMany(keys []string) (MultiProof, error) {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+	return ct.trie.ProveMany(keys)
+}
+
+// Insert inserts key and value. It behaves like MerklePatriciaTrie.Insert.
+func (ct *ConcurrentTrie) Insert(key string, value string) {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	ct.trie.Insert(key, value)
+}
+
+// InsertBatch inserts every key and value of batch. It behaves like MerklePatriciaTrie.InsertBatch.
+func (ct *ConcurrentTrie) InsertBatch(batch map[string]string) {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	ct.trie.InsertBatch(batch)
+}
+
+// Delete removes key. It behaves like MerklePatriciaTrie.Delete.
+func (ct *ConcurrentTrie) Delete(key string) (string, error) {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	return ct.trie.Delete(key)
+}
+
+// Read calls fn with the trie while holding the read lock, for reads that are not covered by the other methods,
+// such as iteration. fn must not update the trie or keep it after returning.
+func (ct *ConcurrentTrie) Read(fn func(mpt *MerklePatriciaTrie)) {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+	fn(&ct.trie)
+}
+
+// Update calls fn with the trie while holding the write lock, so that several updates are seen by readers all at
+// once. fn must not keep the trie after returning.
+func (ct *ConcurrentTrie) Update(fn func(mpt *MerklePatriciaTrie)) {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	fn(&ct.trie)
+}
+
+// Clone returns a deep copy of the current state of the trie. The copy shares nothing with ct, so it can be read
+// and updated without any locking, for example to build the trie of the next block.
+func (ct *ConcurrentTrie) Clone() MerklePatriciaTrie {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+	return ct.trie.Clone()
+}
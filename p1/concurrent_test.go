@@ -0,0 +1,82 @@
+package p1
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentTrie updates a ConcurrentTrie from several goroutines while others read and prove keys, and
+// checks the result matches a trie built by a single goroutine. Run it with -race.
+func TestConcurrentTrie(t *testing.T) {
+	const writers, keysPerWriter = 4, 50
+	var keys []string
+	for w := 0; w < writers; w++ {
+		for i := 0; i < keysPerWriter; i++ {
+			keys = append(keys, fmt.Sprintf("w%d-%d", w, i))
+		}
+	}
+	// Get fails on an empty trie, so the readers start with the first key in place.
+	ct := NewConcurrentTrie(insertKeys(keys[:1]))
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(own []string) {
+			defer wg.Done()
+			for i, k := range own {
+				if i%10 == 0 {
+					ct.InsertBatch(map[string]string{k: "v" + k})
+				} else {
+					ct.Insert(k, "v"+k)
+				}
+			}
+			ct.Update(func(mpt *MerklePatriciaTrie) {
+				mpt.Insert(own[0]+"-tmp", "tmp")
+				mpt.Delete(own[0] + "-tmp")
+			})
+		}(keys[w*keysPerWriter : (w+1)*keysPerWriter])
+	}
+	for r := 0; r < writers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < keysPerWriter; i++ {
+				k := keys[(r*keysPerWriter+i*7)%len(keys)]
+				root := ct.Root()
+				if v, err := ct.Get(k); err != nil || (v != "" && v != "v"+k) {
+					t.Errorf("Get(%q) = %q, %v", k, v, err)
+				}
+				if proof, err := ct.Prove(k); err == nil {
+					// The root may have moved on since it was read, so only a proof for it is checked.
+					if ct.Root() == root {
+						if err := VerifyProof(root, k, "v"+k, proof); err != nil {
+							t.Errorf("proof of %q: %v", k, err)
+						}
+					}
+				}
+				ct.ProveAbsence("missing")
+				ct.ProveMany([]string{k, "missing"})
+				ct.Read(func(mpt *MerklePatriciaTrie) {
+					for it := mpt.Iter(); it.Next(); {
+					}
+				})
+				clone := ct.Clone()
+				clone.Insert("clone", "only")
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	if want := insertKeys(keys); ct.Root() != want.Root {
+		t.Errorf("root %s, want %s", ct.Root(), want.Root)
+	}
+	for _, k := range keys {
+		if v, err := ct.Get(k); err != nil || v != "v"+k {
+			t.Errorf("Get(%q) = %q, %v", k, v, err)
+		}
+	}
+	if v, _ := ct.Get("clone"); v != "" {
+		t.Error("insert into a clone changed the shared trie")
+	}
+}
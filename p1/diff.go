@@ -0,0 +1,101 @@
+package p1
+
+// KeyChange is a key whose value differs between two tries. Old is "" for an added key and New is "" for a
+// removed key.
+type KeyChange struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// TrieDiff lists the keys that were added, removed or changed going from one trie to another.
+// Every list is sorted by key.
+type TrieDiff struct {
+	Added   []KeyChange `json:"added"`
+	Removed []KeyChange `json:"removed"`
+	Changed []KeyChange `json:"changed"`
+}
+
+// diffRef points at a position inside a trie: the node under hash, with the first offset nibbles of its path
+// already consumed. An empty hash means there is nothing at that position.
+type diffRef struct {
+	hash   string
+	offset int
+}
+
+// Diff walks a and b in parallel and returns the keys that differ between them. Subtrees with the same hash
+// in both tries are identical and are skipped without being visited.
+func Diff(a *MerklePatriciaTrie, b *MerklePatriciaTrie) TrieDiff {
+	diff := TrieDiff{}
+	diffNodes(a, b, a.rootRef(), b.rootRef(), []uint8{}, &diff)
+	return diff
+}
+
+// rootRef returns the position of the root of the trie.
+func (mpt *MerklePatriciaTrie) rootRef() diffRef {
+	if mpt.Root == "" || mpt.db == nil || mpt.getNode(mpt.Root).nodeType == 0 {
+		return diffRef{}
+	}
+	return diffRef{mpt.Root, 0}
+}
+
+// diffNodes compares the positions refA of a and refB of b, which are both reached by path, and records
+// every differing key below them in diff.
+func diffNodes(a *MerklePatriciaTrie, b *MerklePatriciaTrie, refA diffRef, refB diffRef, path []uint8,
+	diff *TrieDiff) {
+	if refA == refB {
+		return
+	}
+	valueA, childrenA := a.diffView(refA)
+	valueB, childrenB := b.diffView(refB)
+	key := string(hexToAsciiArray(path))
+	if valueA != valueB {
+		if valueA == "" {
+			diff.Added = append(diff.Added, KeyChange{key, "", valueB})
+		} else if valueB == "" {
+			diff.Removed = append(diff.Removed, KeyChange{key, valueA, ""})
+		} else {
+			diff.Changed = append(diff.Changed, KeyChange{key, valueA, valueB})
+		}
+	}
+	for i := 0; i < 16; i++ {
+		if childrenA[i].hash != "" || childrenB[i].hash != "" {
+			diffNodes(a, b, childrenA[i], childrenB[i], joinNibbles(path, []uint8{uint8(i)}), diff)
+		}
+	}
+}
+
+// diffView describes the position ref one nibble at a time. It returns the value stored at the position and
+// the positions reached by each of the 16 nibbles.
+func (mpt *MerklePatriciaTrie) diffView(ref diffRef) (string, [16]diffRef) {
+	var children [16]diffRef
+	if ref.hash == "" {
+		return "", children
+	}
+	node := mpt.getNode(ref.hash)
+	if node.nodeType == 1 { // branch
+		for i, v := range node.branchValue[:16] {
+			children[i] = diffRef{v, 0}
+			if v == "" {
+				children[i] = diffRef{}
+			}
+		}
+		return node.branchValue[16], children
+	} else if node.nodeType == 2 { // leaf or ext
+		decodedPrefix := compactDecode(node.flagValue.encodedPrefix)
+		if ref.offset < len(decodedPrefix) {
+			next := diffRef{ref.hash, ref.offset + 1}
+			if next.offset == len(decodedPrefix) && isExtNode(node.flagValue.encodedPrefix) {
+				// Point straight at the branch below the ext so that equal branches are skipped
+				next = diffRef{node.flagValue.value, 0}
+			}
+			children[decodedPrefix[ref.offset]] = next
+			return "", children
+		}
+		if isExtNode(node.flagValue.encodedPrefix) {
+			return mpt.diffView(diffRef{node.flagValue.value, 0})
+		}
+		return node.flagValue.value, children
+	}
+	return "", children
+}
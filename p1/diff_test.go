@@ -0,0 +1,66 @@
+package p1
+
+import (
+	"reflect"
+	"testing"
+)
+
+// trieOf returns a new trie holding every key of values with its value.
+func trieOf(values map[string]string) MerklePatriciaTrie {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	for k, v := range values {
+		mpt.Insert(k, v)
+	}
+	return mpt
+}
+
+// TestDiff checks the added, removed and changed keys Diff finds between two tries, including tries whose keys
+// split their paths at different nibbles.
+func TestDiff(t *testing.T) {
+	base := map[string]string{"do": "1", "dog": "2", "doge": "3", "horse": "4"}
+	cases := []struct {
+		name string
+		a, b map[string]string
+		want TrieDiff
+	}{
+		{"identical", base, base, TrieDiff{}},
+		{"added", base, map[string]string{"do": "1", "dog": "2", "doge": "3", "horse": "4", "dot": "5"},
+			TrieDiff{Added: []KeyChange{{"dot", "", "5"}}}},
+		{"removed", base, map[string]string{"do": "1", "doge": "3", "horse": "4"},
+			TrieDiff{Removed: []KeyChange{{"dog", "2", ""}}}},
+		{"changed", base, map[string]string{"do": "1", "dog": "two", "doge": "3", "horse": "four"},
+			TrieDiff{Changed: []KeyChange{{"dog", "2", "two"}, {"horse", "4", "four"}}}},
+		{"mixed", base, map[string]string{"d": "0", "do": "one", "doge": "3", "horse": "4"},
+			TrieDiff{
+				Added:   []KeyChange{{"d", "", "0"}},
+				Removed: []KeyChange{{"dog", "2", ""}},
+				Changed: []KeyChange{{"do", "1", "one"}},
+			}},
+		{"split extension", map[string]string{"ab": "1", "ac": "2"}, map[string]string{"ab": "1", "ac": "2", "b": "3"},
+			TrieDiff{Added: []KeyChange{{"b", "", "3"}}}},
+		{"empty to full", map[string]string{}, map[string]string{"a": "1", "b": "2"},
+			TrieDiff{Added: []KeyChange{{"a", "", "1"}, {"b", "", "2"}}}},
+		{"full to empty", map[string]string{"a": "1", "b": "2"}, map[string]string{},
+			TrieDiff{Removed: []KeyChange{{"a", "1", ""}, {"b", "2", ""}}}},
+		{"both empty", map[string]string{}, map[string]string{}, TrieDiff{}},
+	}
+	for _, c := range cases {
+		a, b := trieOf(c.a), trieOf(c.b)
+		if diff := Diff(&a, &b); !reflect.DeepEqual(diff, c.want) {
+			t.Errorf("%s: Diff = %+v, want %+v", c.name, diff, c.want)
+		}
+	}
+}
+
+// TestDiffUninitialized checks that a trie that was never initialized diffs like an empty one.
+func TestDiffUninitialized(t *testing.T) {
+	empty := MerklePatriciaTrie{}
+	full := trieOf(map[string]string{"a": "1"})
+	if diff := Diff(&empty, &full); !reflect.DeepEqual(diff, TrieDiff{Added: []KeyChange{{"a", "", "1"}}}) {
+		t.Errorf("Diff from an uninitialized trie = %+v", diff)
+	}
+	if diff := Diff(&full, &empty); !reflect.DeepEqual(diff, TrieDiff{Removed: []KeyChange{{"a", "1", ""}}}) {
+		t.Errorf("Diff to an uninitialized trie = %+v", diff)
+	}
+}
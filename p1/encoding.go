@@ -0,0 +1,176 @@
+package p1
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+)
+
+// Canonical node encoding
+//
+// Every node is encoded as a type byte followed by its fields:
+//
+//	branch:    0x01 | child(0) | ... | child(15) | bytes(value)
+//	extension: 0x02 | bytes(path) | hash(next)
+//	leaf:      0x03 | bytes(path) | bytes(value)
+//
+// where
+//
+//	child(i) is 0x00 for an empty slot, or 0x01 followed by hash(child) for a filled slot.
+//	hash(x)  is the raw 32 byte hash of node x.
+//	bytes(x) is the length of x as a 4 byte big-endian unsigned integer, followed by x.
+//	path     is the compact (hex-prefix) encoding of the nibbles of the node, the same as encodedPrefix.
+//	value    is the bytes of the stored value. A branch without a value has an empty value.
+//
+// The hash of a node is the SHA3-256 of its encoding. Outside of the encoding, hashes are written as 64 lower
+// case hex characters, which is the form used by Root, NodeStore and Proof. An empty trie has the root "".
+//
+// For example the leaf holding "v" under the nibbles [6, 1] encodes to
+//
+//	03 00000002 2061 00000001 76
+//
+// Because the path and the node type are part of the encoding, two nodes only share a hash if they are the same
+// node, and a root can be recomputed by any client that implements this encoding.
+
+// Node type bytes of the canonical encoding.
+const (
+	encodedBranch uint8 = 1
+	encodedExt    uint8 = 2
+	encodedLeaf   uint8 = 3
+)
+
+// hashLength is the number of bytes in a node hash.
+const hashLength = 32
+
+// encode returns the canonical encoding of node. The child hashes of node must be valid.
+func (node *Node) encode() []byte {
+	var encoded []byte
+	switch node.nodeType {
+	case 1:
+		encoded = []byte{encodedBranch}
+		for _, v := range node.branchValue[:16] {
+			if v == "" {
+				encoded = append(encoded, 0)
+			} else {
+				encoded = append(append(encoded, 1), decodeHash(v)...)
+			}
+		}
+		encoded = appendBytes(encoded, []byte(node.branchValue[16]))
+	case 2:
+		if isExtNode(node.flagValue.encodedPrefix) {
+			encoded = appendBytes([]byte{encodedExt}, node.flagValue.encodedPrefix)
+			encoded = append(encoded, decodeHash(node.flagValue.value)...)
+		} else {
+			encoded = appendBytes([]byte{encodedLeaf}, node.flagValue.encodedPrefix)
+			encoded = appendBytes(encoded, []byte(node.flagValue.value))
+		}
+	}
+	return encoded
+}
+
+// decodeNode decodes the canonical encoding of a node. An error is returned if encoded is not a valid encoding.
+func decodeNode(encoded []byte) (Node, error) {
+	if len(encoded) == 0 {
+		return Node{}, errors.New("empty node encoding")
+	}
+	rest := encoded[1:]
+	var node Node
+	var err error
+	switch encoded[0] {
+	case encodedBranch:
+		node = Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
+		for i := 0; i < 16; i++ {
+			if len(rest) == 0 {
+				return Node{}, errors.New("truncated node encoding")
+			}
+			if rest[0] == 1 {
+				if len(rest) < 1+hashLength {
+					return Node{}, errors.New("truncated node encoding")
+				}
+				node.branchValue[i] = hex.EncodeToString(rest[1 : 1+hashLength])
+				rest = rest[1+hashLength:]
+			} else if rest[0] == 0 {
+				rest = rest[1:]
+			} else {
+				return Node{}, errors.New("invalid branch slot")
+			}
+		}
+		var value []byte
+		if value, rest, err = readBytes(rest); err != nil {
+			return Node{}, err
+		}
+		node.branchValue[16] = string(value)
+	case encodedExt, encodedLeaf:
+		var path []byte
+		if path, rest, err = readBytes(rest); err != nil {
+			return Node{}, err
+		}
+		if !validPrefix(path) || isExtNode(path) != (encoded[0] == encodedExt) {
+			return Node{}, errors.New("invalid path")
+		}
+		node = Node{2, [17]string{}, FlagValue{path, ""}}
+		if encoded[0] == encodedExt {
+			if len(rest) < hashLength {
+				return Node{}, errors.New("truncated node encoding")
+			}
+			node.flagValue.value = hex.EncodeToString(rest[:hashLength])
+			rest = rest[hashLength:]
+		} else {
+			var value []byte
+			if value, rest, err = readBytes(rest); err != nil {
+				return Node{}, err
+			}
+			node.flagValue.value = string(value)
+		}
+	default:
+		return Node{}, errors.New("invalid node type")
+	}
+	if len(rest) != 0 {
+		return Node{}, errors.New("trailing bytes in node encoding")
+	}
+	return node, nil
+}
+
+// appendBytes appends field to encoded with its length in front.
+func appendBytes(encoded []byte, field []byte) []byte {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(field)))
+	return append(append(encoded, length[:]...), field...)
+}
+
+// readBytes reads a field written by appendBytes. It returns the field and the bytes after it.
+func readBytes(encoded []byte) ([]byte, []byte, error) {
+	if len(encoded) < 4 {
+		return nil, nil, errors.New("truncated node encoding")
+	}
+	length := binary.BigEndian.Uint32(encoded)
+	if uint64(len(encoded)-4) < uint64(length) {
+		return nil, nil, errors.New("truncated node encoding")
+	}
+	return encoded[4 : 4+length], encoded[4+length:], nil
+}
+
+// decodeHash converts a hex hash to its raw bytes.
+func decodeHash(hash string) []byte {
+	raw, _ := hex.DecodeString(hash)
+	return raw
+}
+
+// validHash tests if hash is a hex string of the right length.
+func validHash(hash string) bool {
+	raw, err := hex.DecodeString(hash)
+	return err == nil && len(raw) == hashLength
+}
+
+// validPrefix tests if encodedPrefix is a canonical compact encoding.
+func validPrefix(encodedPrefix []uint8) bool {
+	if len(encodedPrefix) == 0 {
+		return false
+	}
+	flags := encodedPrefix[0] / 16
+	if flags > 3 {
+		return false
+	}
+	// Even length paths pad the flag nibble with a zero
+	return flags%2 == 1 || encodedPrefix[0]%16 == 0
+}
@@ -0,0 +1,140 @@
+package p1
+
+// Compact removes every node from the store of the trie that is not reachable from Root or from one of the
+// given roots. Pass the roots of the snapshots and of the other tries that share the store, otherwise their
+// nodes are removed as well. Compact returns the number of removed nodes.
+//
+// A FileStore only marks the nodes as deleted. Call FileStore.Rewrite afterwards to reclaim the disk space.
+func (mpt *MerklePatriciaTrie) Compact(roots ...string) int {
+	if mpt.db == nil {
+		return 0
+	}
+	return CompactStore(mpt.db, append([]string{mpt.Root}, roots...))
+}
+
+// CompactStore marks every node of store that is reachable from one of the roots and sweeps away the rest.
+// It returns the number of removed nodes.
+func CompactStore(store NodeStore, roots []string) int {
+	marked := make(map[string]bool)
+	stack := []string{}
+	for _, root := range roots {
+		if root != "" {
+			stack = append(stack, root)
+		}
+	}
+	for len(stack) != 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if marked[hash] {
+			continue
+		}
+		node, ok := store.Get(hash)
+		if !ok {
+			continue
+		}
+		marked[hash] = true
+		stack = append(stack, node.children()...)
+	}
+	removed := 0
+	for _, hash := range store.Hashes() {
+		if !marked[hash] {
+			store.Delete(hash)
+			removed++
+		}
+	}
+	return removed
+}
+
+// RefCountStore wraps a NodeStore and counts the references to every node, so that nodes are removed as soon
+// as nothing refers to them anymore. A node is referenced once by every distinct stored node that points to it
+// and once for every Retain of it as a root.
+//
+// A MerklePatriciaTrie kept in a RefCountStore retains its current root, and releases the old root whenever an
+// update replaces it. Snapshots and shared clones retain their own roots. Only the child references are
+// recovered when a RefCountStore is created over an existing store, so the roots of tries loaded from it are
+// retained again by LoadStore, and nodes that nothing retains are left to Compact.
+type RefCountStore struct {
+	store NodeStore
+	refs  map[string]int
+}
+
+// NewRefCountStore wraps store. The references between the nodes already in store are counted.
+func NewRefCountStore(store NodeStore) *RefCountStore {
+	refStore := &RefCountStore{store: store, refs: make(map[string]int)}
+	for _, hash := range store.Hashes() {
+		node, _ := store.Get(hash)
+		for _, child := range node.children() {
+			refStore.refs[child]++
+		}
+	}
+	return refStore
+}
+
+// Get returns the node stored under hash and whether it was found.
+func (refStore *RefCountStore) Get(hash string) (Node, bool) {
+	return refStore.store.Get(hash)
+}
+
+// Put stores node under hash and adds a reference to each of its children. A node that is already stored is
+// not counted again.
+func (refStore *RefCountStore) Put(hash string, node Node) {
+	if _, ok := refStore.store.Get(hash); ok {
+		return
+	}
+	refStore.store.Put(hash, node)
+	for _, child := range node.children() {
+		refStore.refs[child]++
+	}
+}
+
+// Delete removes the node stored under hash regardless of its references, and drops its references to its
+// children. It is used by CompactStore.
+func (refStore *RefCountStore) Delete(hash string) {
+	node, ok := refStore.store.Get(hash)
+	if !ok {
+		return
+	}
+	refStore.store.Delete(hash)
+	delete(refStore.refs, hash)
+	for _, child := range node.children() {
+		if refStore.refs[child] > 0 {
+			refStore.refs[child]--
+		}
+	}
+}
+
+// Hashes returns the hash of every stored node.
+func (refStore *RefCountStore) Hashes() []string {
+	return refStore.store.Hashes()
+}
+
+// Retain adds a reference to the root under hash.
+func (refStore *RefCountStore) Retain(hash string) {
+	refStore.refs[hash]++
+}
+
+// Release removes a reference to the node under hash. Once a node has no references left it is removed and its
+// children are released in turn.
+func (refStore *RefCountStore) Release(hash string) {
+	stack := []string{hash}
+	for len(stack) != 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if refStore.refs[hash] > 1 {
+			refStore.refs[hash]--
+			continue
+		}
+		delete(refStore.refs, hash)
+		node, ok := refStore.store.Get(hash)
+		if !ok {
+			continue
+		}
+		refStore.store.Delete(hash)
+		stack = append(stack, node.children()...)
+	}
+}
+
+// Refs returns the number of references to the node under hash.
+func (refStore *RefCountStore) Refs(hash string) int {
+	return refStore.refs[hash]
+}
@@ -0,0 +1,75 @@
+package p1
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// refCountTrie returns a new trie over a RefCountStore, and the store.
+func refCountTrie() (MerklePatriciaTrie, *RefCountStore) {
+	store := NewRefCountStore(NewMapStore())
+	mpt := MerklePatriciaTrie{}
+	mpt.InitialStore(store)
+	return mpt, store
+}
+
+// checkNoOrphans fails t if store holds a node that is not reachable from the root of mpt.
+func checkNoOrphans(t *testing.T, mpt *MerklePatriciaTrie, store *RefCountStore, step string) {
+	t.Helper()
+	if report := mpt.Verify(); !report.OK() {
+		t.Fatalf("%s: %+v", step, report)
+	}
+	stats := mpt.Stats()
+	if reachable := stats.Branches + stats.Extensions + stats.Leaves; len(store.Hashes()) != reachable {
+		t.Fatalf("%s: %d nodes stored but %d reachable", step, len(store.Hashes()), reachable)
+	}
+}
+
+// TestRefCountStoreDeleteAll deletes every key from a trie over a RefCountStore and checks that the store is
+// left empty.
+func TestRefCountStoreDeleteAll(t *testing.T) {
+	mpt, store := refCountTrie()
+	keys := []string{"aa", "ab", "ac", "b"}
+	for _, k := range keys {
+		mpt.Insert(k, "v"+k)
+	}
+	for _, k := range keys {
+		if _, err := mpt.Delete(k); err != nil {
+			t.Fatal(err)
+		}
+		if mpt.Root != "" {
+			checkNoOrphans(t, &mpt, store, "delete "+k)
+		}
+	}
+	if mpt.Root != "" || len(store.Hashes()) != 0 {
+		t.Errorf("root %q and %d nodes left after deleting every key", mpt.Root, len(store.Hashes()))
+	}
+}
+
+// TestRefCountStoreRandomUpdates applies random inserts and deletes to a trie over a RefCountStore, checks that
+// no orphaned node is left after each of them, and that the store is empty once every key is deleted.
+func TestRefCountStoreRandomUpdates(t *testing.T) {
+	rnd := rand.New(rand.NewSource(12))
+	for round := 0; round < 20; round++ {
+		mpt, store := refCountTrie()
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("%x", rnd.Intn(64))
+			if rnd.Intn(3) == 0 {
+				mpt.Delete(key)
+			} else {
+				mpt.Insert(key, fmt.Sprint(rnd.Intn(4)))
+			}
+			if mpt.Root != "" {
+				checkNoOrphans(t, &mpt, store, fmt.Sprintf("round %d step %d", round, i))
+			}
+		}
+		for key := range mpt.Values.Db {
+			mpt.Delete(key)
+		}
+		if mpt.Root != "" || len(store.Hashes()) != 0 {
+			t.Fatalf("round %d: root %q and %d nodes left after deleting every key", round, mpt.Root,
+				len(store.Hashes()))
+		}
+	}
+}
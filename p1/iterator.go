@@ -0,0 +1,175 @@
+package p1
+
+import (
+	"bytes"
+)
+
+// Iterator walks the keys of a MerklePatriciaTrie in nibble order, which is the same as byte order of the keys.
+// It follows the branch, extension and leaf nodes of the trie rather than Values.Db.
+type Iterator struct {
+	mpt   *MerklePatriciaTrie
+	stack []iterFrame
+	start []uint8
+	end   []uint8
+	key   string
+	value string
+}
+
+// iterFrame is a pending step of an Iterator. It is either a node still to be expanded or a value to be returned.
+// path holds the nibbles leading up to the node or value.
+type iterFrame struct {
+	hash    string
+	path    []uint8
+	value   string
+	isValue bool
+}
+
+// Iter returns an Iterator over every key in the trie.
+func (mpt *MerklePatriciaTrie) Iter() *Iterator {
+	it := &Iterator{mpt: mpt}
+	if mpt.Root != "" && mpt.db != nil && mpt.getNode(mpt.Root).nodeType != 0 {
+		it.stack = []iterFrame{{hash: mpt.Root}}
+	}
+	return it
+}
+
+// IterPrefix returns an Iterator over the keys that start with prefix.
+func (mpt *MerklePatriciaTrie) IterPrefix(prefix string) *Iterator {
+	it := &Iterator{mpt: mpt}
+	if mpt.Root == "" || mpt.db == nil || mpt.getNode(mpt.Root).nodeType == 0 {
+		return it
+	}
+	hash, path, found := mpt.seekPrefix(asciiToHexArray([]uint8(prefix)))
+	if found {
+		it.stack = []iterFrame{{hash: hash, path: path}}
+	}
+	return it
+}
+
+// Range returns an Iterator over the keys k with start <= k < end. An empty end means there is no upper bound.
+// Subtrees that lie entirely before start are skipped without being visited.
+func (mpt *MerklePatriciaTrie) Range(start string, end string) *Iterator {
+	it := mpt.Iter()
+	it.start = asciiToHexArray([]uint8(start))
+	if end != "" {
+		it.end = asciiToHexArray([]uint8(end))
+	}
+	return it
+}
+
+// Next advances the iterator to the next key. It returns false when there are no keys left.
+func (it *Iterator) Next() bool {
+	for len(it.stack) > 0 {
+		frame := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if frame.isValue {
+			if bytes.Compare(frame.path, it.start) < 0 {
+				continue
+			}
+			if it.end != nil && bytes.Compare(frame.path, it.end) >= 0 {
+				it.stack = nil
+				return false
+			}
+			it.key = string(hexToAsciiArray(frame.path))
+			it.value = frame.value
+			return true
+		}
+		it.expand(frame)
+	}
+	return false
+}
+
+// Key returns the key the iterator currently points at.
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+// Value returns the value the iterator currently points at.
+func (it *Iterator) Value() string {
+	return it.value
+}
+
+// expand pushes the children of the node in frame onto the stack so that they are popped in nibble order.
+func (it *Iterator) expand(frame iterFrame) {
+	node := it.mpt.getNode(frame.hash)
+	if node.nodeType == 1 { // branch
+		for i := 15; i >= 0; i-- {
+			if node.branchValue[i] != "" {
+				it.push(iterFrame{hash: node.branchValue[i], path: joinNibbles(frame.path, []uint8{uint8(i)})})
+			}
+		}
+		if node.branchValue[16] != "" {
+			it.push(iterFrame{path: frame.path, value: node.branchValue[16], isValue: true})
+		}
+	} else if node.nodeType == 2 { // leaf or ext
+		path := joinNibbles(frame.path, compactDecode(node.flagValue.encodedPrefix))
+		if isExtNode(node.flagValue.encodedPrefix) {
+			it.push(iterFrame{hash: node.flagValue.value, path: path})
+		} else {
+			it.push(iterFrame{path: path, value: node.flagValue.value, isValue: true})
+		}
+	}
+}
+
+// push adds frame to the stack unless every key below it sorts before the start of the iterator.
+func (it *Iterator) push(frame iterFrame) {
+	bound := it.start
+	if len(bound) > len(frame.path) {
+		bound = bound[:len(frame.path)]
+	}
+	if bytes.Compare(frame.path, bound) < 0 {
+		return
+	}
+	it.stack = append(it.stack, frame)
+}
+
+// seekPrefix finds the highest node whose keys all start with hexPrefix. It returns the hash of that node,
+// the nibbles leading up to it and whether such a node exists.
+func (mpt *MerklePatriciaTrie) seekPrefix(hexPrefix []uint8) (string, []uint8, bool) {
+	currHash := mpt.Root
+	path := []uint8{}
+	for len(hexPrefix) > 0 {
+		currNode := mpt.getNode(currHash)
+		if currNode.nodeType == 1 { // branch
+			if currNode.branchValue[hexPrefix[0]] == "" {
+				return "", nil, false
+			}
+			path = joinNibbles(path, hexPrefix[:1])
+			currHash = currNode.branchValue[hexPrefix[0]]
+			hexPrefix = hexPrefix[1:]
+		} else if currNode.nodeType == 2 { // leaf or ext
+			decodedPrefix := compactDecode(currNode.flagValue.encodedPrefix)
+			same := similar(decodedPrefix, hexPrefix)
+			if same == len(hexPrefix) {
+				// Every key below this node starts with the prefix
+				return currHash, path, true
+			}
+			if same < len(decodedPrefix) || !isExtNode(currNode.flagValue.encodedPrefix) {
+				return "", nil, false
+			}
+			path = joinNibbles(path, decodedPrefix)
+			currHash = currNode.flagValue.value
+			hexPrefix = hexPrefix[same:]
+		} else {
+			return "", nil, false
+		}
+	}
+	return currHash, path, true
+}
+
+// joinNibbles returns a new array holding the nibbles of a followed by the nibbles of b.
+func joinNibbles(a []uint8, b []uint8) []uint8 {
+	joined := make([]uint8, 0, len(a)+len(b))
+	joined = append(joined, a...)
+	return append(joined, b...)
+}
+
+// hexToAsciiArray converts from a hex array back to an ASCII array. It is the inverse of asciiToHexArray.
+// This function returns the converted ASCII array.
+func hexToAsciiArray(hexArr []uint8) []uint8 {
+	arr := make([]uint8, len(hexArr)/2)
+	for i := range arr {
+		arr[i] = hexArr[i*2]*16 + hexArr[(i*2)+1]
+	}
+	return arr
+}
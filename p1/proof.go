@@ -0,0 +1,229 @@
+package p1
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProofNode is the serializable form of a Node that is handed out as part of a Proof.
+type ProofNode struct {
+	NodeType    int        `json:"nodeType"`
+	BranchValue [17]string `json:"branchValue"`
+	Prefix      []uint8    `json:"prefix"`
+	Value       string     `json:"value"`
+}
+
+// Proof is the ordered list of nodes on the path from the Root of a trie down to a key.
+type Proof []ProofNode
+
+// Prove builds a Proof that key is stored in the trie. The proof contains every branch, extension and leaf
+// node visited on the way from Root to the key. An error is returned if the trie is uninitialized or the key
+// could not be found.
+func (mpt *MerklePatriciaTrie) Prove(key string) (Proof, error) {
+	if len(key) == 0 {
+		return nil, errors.New("missing key")
+	}
+	if mpt.Root == "" || mpt.db == nil || mpt.getNode(mpt.Root).nodeType == 0 {
+		return nil, errors.New("uninitialized trie")
+	}
+	proof, value := mpt.provePath(asciiToHexArray([]uint8(key)))
+	if value == "" {
+		return nil, errors.New("key not found")
+	}
+	return proof, nil
+}
+
+// provePath walks hexKey from the Root and collects every node on the way.
+// It returns the collected nodes and the value found at the end of the path, or "" if the key is absent.
+func (mpt *MerklePatriciaTrie) provePath(hexKey []uint8) (Proof, string) {
+	var proof Proof
+	currHash := mpt.Root
+	for {
+		currNode := mpt.getNode(currHash)
+		proof = append(proof, currNode.toProofNode())
+		nextHash, rest, value := currNode.step(hexKey)
+		if nextHash == "" {
+			return proof, value
+		}
+		currHash, hexKey = nextHash, rest
+	}
+}
+
+// VerifyProof checks that proof shows key mapping to value under the given root hash. It does not need
+// access to the trie itself. An error describing the first mismatch is returned if the proof is not valid.
+func VerifyProof(root string, key string, value string, proof Proof) error {
+	if len(key) == 0 || len(value) == 0 {
+		return errors.New("missing key or value")
+	}
+	found, err := verifyProofPath(root, asciiToHexArray([]uint8(key)), proof)
+	if err != nil {
+		return err
+	}
+	if found != value {
+		return errors.New("value does not match proof")
+	}
+	return nil
+}
+
+// ProveAbsence builds a Proof that key is not stored in the trie. The proof contains the nodes from Root down
+// to the point where the path for key ends or diverges. The proof for an uninitialized trie is empty.
+// An error is returned if the key is present.
+func (mpt *MerklePatriciaTrie) ProveAbsence(key string) (Proof, error) {
+	if len(key) == 0 {
+		return nil, errors.New("missing key")
+	}
+	if mpt.Root == "" || mpt.db == nil || mpt.getNode(mpt.Root).nodeType == 0 {
+		return Proof{}, nil
+	}
+	proof, value := mpt.provePath(asciiToHexArray([]uint8(key)))
+	if value != "" {
+		return nil, errors.New("key is present")
+	}
+	return proof, nil
+}
+
+// VerifyAbsence checks that proof shows key is not stored under the given root hash. An empty root must come
+// with an empty proof. An error describing the first mismatch is returned if the proof is not valid.
+func VerifyAbsence(root string, key string, proof Proof) error {
+	if len(key) == 0 {
+		return errors.New("missing key")
+	}
+	if root == "" {
+		if len(proof) != 0 {
+			return errors.New("proof contains extra nodes")
+		}
+		return nil
+	}
+	found, err := verifyProofPath(root, asciiToHexArray([]uint8(key)), proof)
+	if err != nil {
+		return err
+	}
+	if found != "" {
+		return errors.New("key is present")
+	}
+	return nil
+}
+
+// verifyProofPath checks that every node in proof hashes to the hash referenced by its parent, starting at
+// root, and that the nodes follow hexKey. It returns the value the path ends in, or "" if the key is absent.
+func verifyProofPath(root string, hexKey []uint8, proof Proof) (string, error) {
+	expectedHash := root
+	for i, proofNode := range proof {
+		node, err := proofNode.toNode()
+		if err != nil {
+			return "", fmt.Errorf("proof node %d: %v", i, err)
+		}
+		if node.hashNode() != expectedHash {
+			return "", fmt.Errorf("proof node %d does not match its hash", i)
+		}
+		nextHash, rest, value := node.step(hexKey)
+		if nextHash == "" {
+			if i != len(proof)-1 {
+				return "", errors.New("proof contains extra nodes")
+			}
+			return value, nil
+		}
+		expectedHash, hexKey = nextHash, rest
+	}
+	return "", errors.New("incomplete proof")
+}
+
+// toProofNode copies node into its serializable form.
+func (node *Node) toProofNode() ProofNode {
+	return ProofNode{node.nodeType, node.branchValue, node.flagValue.encodedPrefix, node.flagValue.value}
+}
+
+// toNode converts a ProofNode back into a Node. An error is returned if the node is malformed.
+func (proofNode *ProofNode) toNode() (Node, error) {
+	switch proofNode.NodeType {
+	case 1:
+		for _, v := range proofNode.BranchValue[:16] {
+			if v != "" && !validHash(v) {
+				return Node{}, errors.New("invalid child hash")
+			}
+		}
+		return Node{1, proofNode.BranchValue, FlagValue{[]uint8{}, ""}}, nil
+	case 2:
+		if !validPrefix(proofNode.Prefix) {
+			return Node{}, errors.New("invalid prefix")
+		}
+		if isExtNode(proofNode.Prefix) && !validHash(proofNode.Value) {
+			return Node{}, errors.New("invalid child hash")
+		}
+		return Node{2, [17]string{}, FlagValue{proofNode.Prefix, proofNode.Value}}, nil
+	}
+	return Node{}, errors.New("invalid node type")
+}
+
+// MultiProof is the set of nodes on the paths from the Root of a trie down to several keys. Nodes shared by
+// the paths, such as the upper branches, are included only once.
+type MultiProof []ProofNode
+
+// ProveMany builds a MultiProof covering every key in keys. For each key the proof shows either its value or
+// that it is absent. The proof for an uninitialized trie is empty. An error is returned if a key is empty.
+func (mpt *MerklePatriciaTrie) ProveMany(keys []string) (MultiProof, error) {
+	proof := MultiProof{}
+	if mpt.Root == "" || mpt.db == nil || mpt.getNode(mpt.Root).nodeType == 0 {
+		for _, key := range keys {
+			if len(key) == 0 {
+				return nil, errors.New("missing key")
+			}
+		}
+		return proof, nil
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, errors.New("missing key")
+		}
+		hexKey := asciiToHexArray([]uint8(key))
+		currHash := mpt.Root
+		for currHash != "" {
+			currNode := mpt.getNode(currHash)
+			if !seen[currHash] {
+				seen[currHash] = true
+				proof = append(proof, currNode.toProofNode())
+			}
+			currHash, hexKey, _ = currNode.step(hexKey)
+		}
+	}
+	return proof, nil
+}
+
+// VerifyMany checks that proof shows every key of values mapping to its value under the given root hash. A
+// value of "" means the key must be absent. Every node of the proof must be used by at least one key.
+// An error describing the first mismatch is returned if the proof is not valid.
+func VerifyMany(root string, values map[string]string, proof MultiProof) error {
+	nodes := make(map[string]Node, len(proof))
+	for i, proofNode := range proof {
+		node, err := proofNode.toNode()
+		if err != nil {
+			return fmt.Errorf("proof node %d: %v", i, err)
+		}
+		nodes[node.hashNode()] = node
+	}
+	used := make(map[string]bool, len(nodes))
+	for key, value := range values {
+		if len(key) == 0 {
+			return errors.New("missing key")
+		}
+		found := ""
+		hexKey := asciiToHexArray([]uint8(key))
+		currHash := root
+		for currHash != "" {
+			node, ok := nodes[currHash]
+			if !ok {
+				return fmt.Errorf("incomplete proof for key %q", key)
+			}
+			used[currHash] = true
+			currHash, hexKey, found = node.step(hexKey)
+		}
+		if found != value {
+			return fmt.Errorf("value of key %q does not match proof", key)
+		}
+	}
+	if len(used) != len(nodes) {
+		return errors.New("proof contains extra nodes")
+	}
+	return nil
+}
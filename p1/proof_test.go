@@ -0,0 +1,135 @@
+package p1
+
+import "testing"
+
+// proofKeys are the keys of the trie the proof tests run against.
+var proofKeys = []string{"apple", "applicant", "apply", "banana", "b", "band"}
+
+// tamper returns a copy of proof with the value of its last node replaced.
+func tamper(proof []ProofNode) []ProofNode {
+	tampered := append([]ProofNode{}, proof...)
+	tampered[len(tampered)-1].Value = "tampered"
+	return tampered
+}
+
+// TestProve checks inclusion proofs built by Prove with VerifyProof.
+func TestProve(t *testing.T) {
+	mpt := insertKeys(proofKeys)
+	other := insertKeys([]string{"apple", "banana"})
+	proof, err := mpt.Prove("applicant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		root  string
+		key   string
+		value string
+		proof Proof
+		valid bool
+	}{
+		{"valid proof", mpt.Root, "applicant", "vapplicant", proof, true},
+		{"wrong value", mpt.Root, "applicant", "vapple", proof, false},
+		{"other key", mpt.Root, "apply", "vapply", proof, false},
+		{"tampered node", mpt.Root, "applicant", "tampered", tamper(proof), false},
+		{"wrong root", other.Root, "applicant", "vapplicant", proof, false},
+		{"truncated proof", mpt.Root, "applicant", "vapplicant", proof[:len(proof)-1], false},
+	}
+	for _, c := range cases {
+		if err := VerifyProof(c.root, c.key, c.value, c.proof); (err == nil) != c.valid {
+			t.Errorf("%s: VerifyProof returned %v", c.name, err)
+		}
+	}
+	if _, err := mpt.Prove("appl"); err == nil {
+		t.Errorf("Prove of an absent key succeeded")
+	}
+}
+
+// TestProveAbsence checks absence proofs built by ProveAbsence with VerifyAbsence.
+func TestProveAbsence(t *testing.T) {
+	mpt := insertKeys(proofKeys)
+	other := insertKeys([]string{"apple", "banana"})
+	proof, err := mpt.ProveAbsence("applied")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inclusion, err := mpt.Prove("apply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := MerklePatriciaTrie{}
+	empty.Initial()
+	emptyProof, err := empty.ProveAbsence("apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		root  string
+		key   string
+		proof Proof
+		valid bool
+	}{
+		{"valid proof", mpt.Root, "applied", proof, true},
+		{"empty trie", "", "apple", emptyProof, true},
+		{"extra nodes for an empty trie", "", "apple", proof, false},
+		{"present key", mpt.Root, "apply", inclusion, false},
+		{"tampered node", mpt.Root, "applied", tamper(proof), false},
+		{"wrong root", other.Root, "applied", proof, false},
+	}
+	for _, c := range cases {
+		if err := VerifyAbsence(c.root, c.key, c.proof); (err == nil) != c.valid {
+			t.Errorf("%s: VerifyAbsence returned %v", c.name, err)
+		}
+	}
+	if _, err := mpt.ProveAbsence("apply"); err == nil {
+		t.Errorf("ProveAbsence of a present key succeeded")
+	}
+}
+
+// TestProveMany checks multi-key proofs built by ProveMany with VerifyMany.
+func TestProveMany(t *testing.T) {
+	mpt := insertKeys(proofKeys)
+	other := insertKeys([]string{"apple", "banana"})
+	keys := []string{"apple", "apply", "band", "bandana"}
+	proof, err := mpt.ProveMany(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{"apple": "vapple", "apply": "vapply", "band": "vband", "bandana": ""}
+	with := func(key string, value string) map[string]string {
+		changed := map[string]string{key: value}
+		for k, v := range values {
+			if k != key {
+				changed[k] = v
+			}
+		}
+		return changed
+	}
+	without := func(key string) map[string]string {
+		changed := with(key, "")
+		delete(changed, key)
+		return changed
+	}
+	cases := []struct {
+		name   string
+		root   string
+		values map[string]string
+		proof  MultiProof
+		valid  bool
+	}{
+		{"valid proof", mpt.Root, values, proof, true},
+		{"wrong value", mpt.Root, with("apply", "vapple"), proof, false},
+		{"absent key claimed present", mpt.Root, with("bandana", "vband"), proof, false},
+		{"present key claimed absent", mpt.Root, with("apple", ""), proof, false},
+		{"key missing from the proof", mpt.Root, with("applicant", "vapplicant"), proof, false},
+		{"extra nodes", mpt.Root, without("apple"), proof, false},
+		{"tampered node", mpt.Root, values, MultiProof(tamper(proof)), false},
+		{"wrong root", other.Root, values, proof, false},
+	}
+	for _, c := range cases {
+		if err := VerifyMany(c.root, c.values, c.proof); (err == nil) != c.valid {
+			t.Errorf("%s: VerifyMany returned %v", c.name, err)
+		}
+	}
+}
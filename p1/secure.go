@@ -0,0 +1,164 @@
+package p1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// SecureTrie is a MerklePatriciaTrie that stores every value under the SHA3-256 hash of its key. Hashed keys are
+// spread evenly, so the depth of the trie stays bounded even for sequential or attacker-chosen keys, and the path
+// of a proof does not reveal the key. The original keys are kept in a preimage table.
+type SecureTrie struct {
+	trie      MerklePatriciaTrie
+	preimages map[string]string
+}
+
+// NewSecureTrie returns a new empty SecureTrie.
+func NewSecureTrie() SecureTrie {
+	st := SecureTrie{preimages: make(map[string]string)}
+	st.trie.Initial()
+	return st
+}
+
+// secureKey returns the key a value is stored under in the underlying trie: the raw SHA3-256 hash of key.
+func secureKey(key string) string {
+	sum := sha3.Sum256([]byte(key))
+	return string(sum[:])
+}
+
+// Root returns the root hash of the underlying trie.
+func (st *SecureTrie) Root() string {
+	return st.trie.Root
+}
+
+// Get finds the value for key. It behaves like MerklePatriciaTrie.Get.
+func (st *SecureTrie) Get(key string) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+	return st.trie.Get(secureKey(key))
+}
+
+// Insert stores value under the hash of key and remembers key as its preimage.
+func (st *SecureTrie) Insert(key string, value string) {
+	if len(key) == 0 || len(value) == 0 {
+		return
+	}
+	if st.preimages == nil {
+		st.preimages = make(map[string]string)
+	}
+	hashedKey := secureKey(key)
+	st.trie.Insert(hashedKey, value)
+	st.preimages[hashedKey] = key
+}
+
+// Delete removes key. It behaves like MerklePatriciaTrie.Delete.
+func (st *SecureTrie) Delete(key string) (string, error) {
+	if len(key) == 0 {
+		return "", errors.New("missing key")
+	}
+	hashedKey := secureKey(key)
+	value, err := st.trie.Delete(hashedKey)
+	if err == nil {
+		delete(st.preimages, hashedKey)
+	}
+	return value, err
+}
+
+// Prove builds a Proof that key is stored in the trie. The proof only contains the hash of key.
+// Check it with VerifySecureProof.
+func (st *SecureTrie) Prove(key string) (Proof, error) {
+	if len(key) == 0 {
+		return nil, errors.New("missing key")
+	}
+	return st.trie.Prove(secureKey(key))
+}
+
+// ProveAbsence builds a Proof that key is not stored in the trie. Check it with VerifySecureAbsence.
+func (st *SecureTrie) ProveAbsence(key string) (Proof, error) {
+	if len(key) == 0 {
+		return nil, errors.New("missing key")
+	}
+	return st.trie.ProveAbsence(secureKey(key))
+}
+
+// VerifySecureProof checks a Proof made by SecureTrie.Prove. It behaves like VerifyProof.
+func VerifySecureProof(root string, key string, value string, proof Proof) error {
+	if len(key) == 0 {
+		return errors.New("missing key or value")
+	}
+	return VerifyProof(root, secureKey(key), value, proof)
+}
+
+// VerifySecureAbsence checks a Proof made by SecureTrie.ProveAbsence. It behaves like VerifyAbsence.
+func VerifySecureAbsence(root string, key string, proof Proof) error {
+	if len(key) == 0 {
+		return errors.New("missing key")
+	}
+	return VerifyAbsence(root, secureKey(key), proof)
+}
+
+// SecureIterator walks the keys of a SecureTrie in the order of their hashes.
+type SecureIterator struct {
+	it        *Iterator
+	preimages map[string]string
+}
+
+// Iter returns a SecureIterator over every key in the trie.
+func (st *SecureTrie) Iter() *SecureIterator {
+	return &SecureIterator{st.trie.Iter(), st.preimages}
+}
+
+// Next advances the iterator to the next key. It returns false when there are no keys left.
+func (it *SecureIterator) Next() bool {
+	return it.it.Next()
+}
+
+// Key returns the original key the iterator currently points at.
+func (it *SecureIterator) Key() string {
+	return it.preimages[it.it.Key()]
+}
+
+// Value returns the value the iterator currently points at.
+func (it *SecureIterator) Value() string {
+	return it.it.Value()
+}
+
+// secureJson is the JSON form of a SecureTrie. Values are listed by their original key.
+type secureJson struct {
+	Root   string  `json:"root"`
+	Values ValueDb `json:"values"`
+}
+
+// MarshalJSON encodes the root of the trie and its values by original key.
+func (st SecureTrie) MarshalJSON() ([]byte, error) {
+	values := make(map[string]string, len(st.preimages))
+	for hashedKey, key := range st.preimages {
+		values[key] = st.trie.Values.Db[hashedKey]
+	}
+	return json.Marshal(secureJson{st.trie.Root, ValueDb{values}})
+}
+
+// UnmarshalJSON decodes a SecureTrie and rebuilds it from its values. An error is returned if the rebuilt root
+// does not match the serialized root.
+func (st *SecureTrie) UnmarshalJSON(data []byte) error {
+	var decoded secureJson
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	rebuilt := NewSecureTrie()
+	hashed := make(map[string]string, len(decoded.Values.Db))
+	for k, v := range decoded.Values.Db {
+		hashed[secureKey(k)] = v
+		rebuilt.preimages[secureKey(k)] = k
+	}
+	rebuilt.trie.InsertBatch(hashed)
+	if rebuilt.trie.Root != decoded.Root {
+		return fmt.Errorf("root mismatch: expected %s but values hash to %s", decoded.Root, rebuilt.trie.Root)
+	}
+	*st = rebuilt
+	return nil
+}
@@ -0,0 +1,98 @@
+package p1
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+// TestSecureTrie checks that a SecureTrie stores values under the hash of their key only, that they can be read
+// back and deleted by the original key, and that its root differs from that of a plain trie with the same values.
+func TestSecureTrie(t *testing.T) {
+	keys := []string{"do", "dog", "doge", "horse"}
+	st := NewSecureTrie()
+	for _, k := range keys {
+		st.Insert(k, "v"+k)
+	}
+	for _, k := range keys {
+		if v, err := st.Get(k); err != nil || v != "v"+k {
+			t.Errorf("Get(%q) = %q, %v", k, v, err)
+		}
+		if v, _ := st.trie.Get(k); v != "" {
+			t.Errorf("raw key %q is stored in the inner trie", k)
+		}
+		if _, ok := st.trie.Values.Db[k]; ok {
+			t.Errorf("raw key %q is in Values.Db of the inner trie", k)
+		}
+	}
+	if plain := insertKeys(keys); st.Root() == plain.Root {
+		t.Error("root is the same as that of a plain trie")
+	}
+
+	var iterated []string
+	for it := st.Iter(); it.Next(); {
+		if it.Value() != "v"+it.Key() {
+			t.Errorf("iterator returned %q for key %q", it.Value(), it.Key())
+		}
+		iterated = append(iterated, it.Key())
+	}
+	sort.Strings(iterated)
+	if len(iterated) != len(keys) {
+		t.Errorf("iterator returned keys %v", iterated)
+	}
+
+	if v, err := st.Delete("dog"); err != nil || v != "vdog" {
+		t.Fatalf("Delete(dog) = %q, %v", v, err)
+	}
+	if v, _ := st.Get("dog"); v != "" {
+		t.Errorf("deleted key dog still has value %q", v)
+	}
+	if _, ok := st.preimages[secureKey("dog")]; ok {
+		t.Error("preimage of deleted key dog is kept")
+	}
+	if v, err := st.Delete("dog"); err != nil || v != "" {
+		t.Errorf("Delete(dog) of a missing key = %q, %v", v, err)
+	}
+	if v, _ := st.Get("doge"); v != "vdoge" {
+		t.Errorf("Get(doge) = %q after deleting dog", v)
+	}
+}
+
+// TestSecureTrieProofsAndJson checks the proofs of a SecureTrie and that it survives a JSON round trip.
+func TestSecureTrieProofsAndJson(t *testing.T) {
+	st := NewSecureTrie()
+	st.Insert("do", "vdo")
+	st.Insert("dog", "vdog")
+	proof, err := st.Prove("dog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySecureProof(st.Root(), "dog", "vdog", proof); err != nil {
+		t.Error(err)
+	}
+	if err := VerifyProof(st.Root(), "dog", "vdog", proof); err == nil {
+		t.Error("proof of a secure key verified for the raw key")
+	}
+	absence, err := st.ProveAbsence("cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySecureAbsence(st.Root(), "cat", absence); err != nil {
+		t.Error(err)
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded SecureTrie
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Root() != st.Root() {
+		t.Errorf("decoded root %s, want %s", decoded.Root(), st.Root())
+	}
+	if v, _ := decoded.Get("dog"); v != "vdog" {
+		t.Errorf("decoded Get(dog) = %q", v)
+	}
+}
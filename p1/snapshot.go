@@ -0,0 +1,71 @@
+package p1
+
+// Snapshot is an immutable version of a MerklePatriciaTrie. It shares its nodes with the trie it was taken
+// from and with every other version of that trie, so taking a snapshot does not copy any nodes.
+type Snapshot struct {
+	trie MerklePatriciaTrie
+}
+
+// Snapshot returns the current version of the trie. Later inserts and deletes only add the nodes on the changed
+// paths and share every unchanged subtree with the snapshot. Replaced nodes are kept in the store until no version
+// uses them: a plain store never removes them, while a RefCountStore frees them once the trie and every snapshot
+// holding them have moved on or been released.
+func (mpt *MerklePatriciaTrie) Snapshot() Snapshot {
+	if mpt.db == nil {
+		mpt.Initial()
+	}
+	snap := Snapshot{MerklePatriciaTrie{db: mpt.db}}
+	snap.trie.setRoot(mpt.Root)
+	return snap
+}
+
+// Release gives up the snapshot. It only has an effect for tries kept in a RefCountStore, where it allows the
+// nodes that are used by no other version to be freed. The snapshot must not be used afterwards.
+func (snap *Snapshot) Release() {
+	snap.trie.setRoot("")
+}
+
+// Root returns the root hash of the snapshot.
+func (snap *Snapshot) Root() string {
+	return snap.trie.Root
+}
+
+// Get finds the value for key in the snapshot. It behaves like MerklePatriciaTrie.Get.
+func (snap *Snapshot) Get(key string) (string, error) {
+	return snap.trie.Get(key)
+}
+
+// Iter returns an Iterator over every key in the snapshot.
+func (snap *Snapshot) Iter() *Iterator {
+	return snap.trie.Iter()
+}
+
+// IterPrefix returns an Iterator over the keys in the snapshot that start with prefix.
+func (snap *Snapshot) IterPrefix(prefix string) *Iterator {
+	return snap.trie.IterPrefix(prefix)
+}
+
+// Prove builds a Proof that key is stored in the snapshot. It behaves like MerklePatriciaTrie.Prove.
+func (snap *Snapshot) Prove(key string) (Proof, error) {
+	return snap.trie.Prove(key)
+}
+
+// ProveAbsence builds a Proof that key is not stored in the snapshot. It behaves like
+// MerklePatriciaTrie.ProveAbsence.
+func (snap *Snapshot) ProveAbsence(key string) (Proof, error) {
+	return snap.trie.ProveAbsence(key)
+}
+
+// Trie returns a new trie that starts at this version. The new trie shares its nodes with the snapshot and
+// only ever adds nodes, so neither the snapshot nor any other version is changed by it.
+// Values.Db of the new trie is rebuilt from the nodes of the snapshot.
+func (snap *Snapshot) Trie() MerklePatriciaTrie {
+	mpt := MerklePatriciaTrie{db: snap.trie.db}
+	mpt.setRoot(snap.trie.Root)
+	mpt.Values.Db = make(map[string]string)
+	it := mpt.Iter()
+	for it.Next() {
+		mpt.Values.Db[it.Key()] = it.Value()
+	}
+	return mpt
+}
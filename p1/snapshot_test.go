@@ -0,0 +1,36 @@
+package p1
+
+import "testing"
+
+// TestSnapshotKeepsVersion checks that a snapshot still reads the values it was taken with after the trie is
+// updated, including when two leaves with different paths hold the same value.
+func TestSnapshotKeepsVersion(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("ax", "v")
+	mpt.Insert("by", "v")
+	mpt.Insert("abc", "x")
+	snap := mpt.Snapshot()
+	mpt.Insert("ax", "w")
+	mpt.Delete("abc")
+	mpt.Insert("c", "v")
+
+	for k, v := range map[string]string{"ax": "v", "by": "v", "abc": "x"} {
+		if got, err := snap.Get(k); err != nil || got != v {
+			t.Errorf("snapshot Get(%q) = %q, %v, expected %q", k, got, err, v)
+		}
+	}
+	for k, v := range map[string]string{"ax": "w", "by": "v", "c": "v"} {
+		if got, err := mpt.Get(k); err != nil || got != v {
+			t.Errorf("Get(%q) = %q, %v, expected %q", k, got, err, v)
+		}
+	}
+	if got, _ := snap.Get("c"); got != "" {
+		t.Errorf("snapshot Get(c) found a key inserted after the snapshot")
+	}
+	trie := snap.Trie()
+	trie.Insert("by", "z")
+	if got, _ := snap.Get("by"); got != "v" {
+		t.Errorf("snapshot Get(by) = %q after updating a trie started from it", got)
+	}
+}
@@ -0,0 +1,319 @@
+package p1
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// NodeStore keeps the nodes of a MerklePatriciaTrie by their hash.
+type NodeStore interface {
+	// Get returns the node stored under hash and whether it was found.
+	Get(hash string) (Node, bool)
+	// Put stores node under hash.
+	Put(hash string, node Node)
+	// Delete removes the node stored under hash if it exists.
+	Delete(hash string)
+	// Hashes returns the hash of every stored node.
+	Hashes() []string
+}
+
+// MapStore is an in-memory NodeStore. It is the default store of a MerklePatriciaTrie.
+type MapStore map[string]Node
+
+// NewMapStore returns a new empty MapStore.
+func NewMapStore() MapStore {
+	return make(MapStore)
+}
+
+// Get returns the node stored under hash and whether it was found.
+func (store MapStore) Get(hash string) (Node, bool) {
+	node, ok := store[hash]
+	return node, ok
+}
+
+// Put stores node under hash.
+func (store MapStore) Put(hash string, node Node) {
+	store[hash] = node
+}
+
+// Delete removes the node stored under hash if it exists.
+func (store MapStore) Delete(hash string) {
+	delete(store, hash)
+}
+
+// Hashes returns the hash of every stored node.
+func (store MapStore) Hashes() []string {
+	hashes := make([]string, 0, len(store))
+	for hash := range store {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// Record types of a FileStore.
+const (
+	filePut    uint8 = 1
+	fileDelete uint8 = 2
+)
+
+// FileStore is a NodeStore backed by an append-only file. Only the position of every node is kept in memory,
+// the nodes themselves are read from disk when they are needed.
+//
+// Each record in the file is a record type byte, the length of the hash as a big-endian uint32, the hash and,
+// for puts, the length of the node as a big-endian uint32 followed by the canonical encoding of the node.
+//
+// The NodeStore interface has no error returns, so the first error the store runs into is kept. Once an error
+// occurred every later Put and Delete is ignored. The error is returned by Err and Close.
+type FileStore struct {
+	path  string
+	file  *os.File
+	index map[string]fileEntry
+	size  int64
+	err   error
+	mux   sync.Mutex
+}
+
+// fileEntry is the position of an encoded node within the file of a FileStore.
+type fileEntry struct {
+	offset int64
+	length uint32
+}
+
+// OpenFileStore opens the FileStore at path, creating the file if it does not exist. The records in the file
+// are replayed to rebuild the index. A record that was only partially written is cut off.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	store := &FileStore{path: path, file: file, index: make(map[string]fileEntry)}
+	if err := store.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// load reads every record of the file and rebuilds the index.
+func (store *FileStore) load() error {
+	reader := bufio.NewReader(store.file)
+	var offset int64
+	for {
+		recordType, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		hash, err := readField(reader)
+		if err != nil {
+			return store.truncate(offset, err)
+		}
+		length := int64(1 + 4 + len(hash))
+		switch recordType {
+		case filePut:
+			body, err := readField(reader)
+			if err != nil {
+				return store.truncate(offset, err)
+			}
+			store.index[string(hash)] = fileEntry{offset + length + 4, uint32(len(body))}
+			length += int64(4 + len(body))
+		case fileDelete:
+			delete(store.index, string(hash))
+		default:
+			return errors.New("corrupt node store")
+		}
+		offset += length
+	}
+	store.size = offset
+	return nil
+}
+
+// truncate cuts off a partially written record at the end of the file. Any other read error is returned.
+func (store *FileStore) truncate(offset int64, err error) error {
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	store.size = offset
+	return store.file.Truncate(offset)
+}
+
+// readField reads a length prefixed field.
+func readField(reader io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	field := make([]byte, length)
+	if _, err := io.ReadFull(reader, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// Get returns the node stored under hash and whether it was found.
+func (store *FileStore) Get(hash string) (Node, bool) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	entry, ok := store.index[hash]
+	if !ok {
+		return Node{}, false
+	}
+	body := make([]byte, entry.length)
+	if _, err := store.file.ReadAt(body, entry.offset); err != nil {
+		store.setErr(err)
+		return Node{}, false
+	}
+	node, err := decodeNode(body)
+	if err != nil {
+		store.setErr(err)
+		return Node{}, false
+	}
+	return node, true
+}
+
+// Put stores node under hash. Nodes are addressed by their content, so a hash that is already stored is not
+// written again.
+func (store *FileStore) Put(hash string, node Node) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	if _, ok := store.index[hash]; ok || store.err != nil {
+		return
+	}
+	body := node.encode()
+	record := appendBytes([]byte{filePut}, []byte(hash))
+	if store.append(appendBytes(record, body)) {
+		store.index[hash] = fileEntry{store.size - int64(len(body)), uint32(len(body))}
+	}
+}
+
+// Delete removes the node stored under hash if it exists.
+func (store *FileStore) Delete(hash string) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	if _, ok := store.index[hash]; !ok || store.err != nil {
+		return
+	}
+	if store.append(appendBytes([]byte{fileDelete}, []byte(hash))) {
+		delete(store.index, hash)
+	}
+}
+
+// Rewrite replaces the file of the store with one that only holds the nodes that are still stored, which
+// reclaims the space taken by deleted nodes. The new file is written next to the old one and renamed over it.
+func (store *FileStore) Rewrite() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	if store.err != nil {
+		return store.err
+	}
+	tmpPath := store.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	index := make(map[string]fileEntry, len(store.index))
+	var size int64
+	for hash, entry := range store.index {
+		body := make([]byte, entry.length)
+		if _, err = store.file.ReadAt(body, entry.offset); err != nil {
+			break
+		}
+		record := appendBytes(appendBytes([]byte{filePut}, []byte(hash)), body)
+		if _, err = writer.Write(record); err != nil {
+			break
+		}
+		size += int64(len(record))
+		index[hash] = fileEntry{size - int64(len(body)), entry.length}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, store.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	store.file.Close()
+	store.file = tmp
+	store.index = index
+	store.size = size
+	return nil
+}
+
+// Hashes returns the hash of every stored node.
+func (store *FileStore) Hashes() []string {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	hashes := make([]string, 0, len(store.index))
+	for hash := range store.index {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// append writes record to the end of the file. It returns false if the record could not be written.
+func (store *FileStore) append(record []byte) bool {
+	if _, err := store.file.WriteAt(record, store.size); err != nil {
+		store.setErr(err)
+		return false
+	}
+	store.size += int64(len(record))
+	return true
+}
+
+// setErr keeps err if it is the first error of the store.
+func (store *FileStore) setErr(err error) {
+	if store.err == nil {
+		store.err = err
+	}
+}
+
+// Err returns the first error the store ran into.
+func (store *FileStore) Err() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return store.err
+}
+
+// Close closes the file of the store. It returns the first error the store ran into, if any.
+func (store *FileStore) Close() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	closeErr := store.file.Close()
+	if store.err != nil {
+		return store.err
+	}
+	return closeErr
+}
+
+// LoadStore opens the trie with the given root from store. Values.Db is rebuilt from the nodes of the trie.
+// The old root is released from the store it was kept in. An error is returned if the root is not in the store.
+func (mpt *MerklePatriciaTrie) LoadStore(store NodeStore, root string) error {
+	if _, ok := store.Get(root); !ok {
+		return errors.New("root not found in store")
+	}
+	oldStore, oldRoot := mpt.db, mpt.Root
+	mpt.db, mpt.Root = store, ""
+	mpt.setRoot(root)
+	if refStore, ok := oldStore.(*RefCountStore); ok && oldRoot != "" {
+		refStore.Release(oldRoot)
+	}
+	mpt.Values.Db = make(map[string]string)
+	it := mpt.Iter()
+	for it.Next() {
+		mpt.Values.Db[it.Key()] = it.Value()
+	}
+	return nil
+}
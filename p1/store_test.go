@@ -0,0 +1,249 @@
+package p1
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testLeaf returns the leaf holding value under the nibbles [6, 1].
+func testLeaf(value string) Node {
+	return Node{2, [17]string{}, FlagValue{[]uint8{0x20, 0x61}, value}}
+}
+
+// openTestStore opens the FileStore at path and fails t if it can not be opened.
+func openTestStore(t *testing.T, path string) *FileStore {
+	t.Helper()
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// fileSize returns the size of the file at path.
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+// TestFileStoreRoundTrip writes a trie to a FileStore, reopens the file and checks the trie loads with every
+// value.
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	store := openTestStore(t, path)
+	mpt := MerklePatriciaTrie{}
+	mpt.InitialStore(store)
+	keys := []string{"do", "dog", "doge", "horse", "hors"}
+	for _, k := range keys {
+		mpt.Insert(k, "v"+k)
+	}
+	if _, err := mpt.Delete("hors"); err != nil {
+		t.Fatal(err)
+	}
+	root := mpt.Root
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	loaded := MerklePatriciaTrie{}
+	if err := loaded.LoadStore(store, root); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys[:4] {
+		if v, err := loaded.Get(k); err != nil || v != "v"+k {
+			t.Errorf("Get(%q) = %q, %v", k, v, err)
+		}
+	}
+	if v, _ := loaded.Get("hors"); v != "" {
+		t.Errorf("deleted key hors loaded with value %q", v)
+	}
+	if len(loaded.Values.Db) != 4 {
+		t.Errorf("Values.Db has %d keys, want 4", len(loaded.Values.Db))
+	}
+	if report := loaded.Verify(); !report.OK() {
+		t.Errorf("loaded trie is not consistent: %+v", report)
+	}
+	if err := loaded.LoadStore(store, "missing"); err == nil {
+		t.Error("LoadStore accepted a root that is not in the store")
+	}
+}
+
+// TestFileStoreTruncatedTail cuts off the last record of a FileStore and checks that reopening it keeps the records
+// before it and cuts the partial record off the file.
+func TestFileStoreTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	store := openTestStore(t, path)
+	store.Put("x", testLeaf("x"))
+	complete := fileSize(t, path)
+	store.Put("y", testLeaf("y"))
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, fileSize(t, path)-3); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openTestStore(t, path)
+	if _, ok := store.Get("x"); !ok {
+		t.Error("complete record x was not loaded")
+	}
+	if _, ok := store.Get("y"); ok {
+		t.Error("partial record y was loaded")
+	}
+	if size := fileSize(t, path); size != complete {
+		t.Errorf("file size is %d after opening, want %d", size, complete)
+	}
+	store.Put("y", testLeaf("y"))
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	if node, ok := store.Get("y"); !ok || node.flagValue.value != "y" {
+		t.Errorf("record y written after the truncation loaded as %v, %v", node, ok)
+	}
+	if err := store.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestFileStoreCorrupt checks that a record of an unknown type fails OpenFileStore, and that a node that can not be
+// decoded is kept as the error of the store.
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	store := openTestStore(t, path)
+	store.Put("x", testLeaf("x"))
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The node of the record starts after the type byte, the hash "x" and the two lengths.
+	if _, err := file.WriteAt([]byte{9}, 1+4+1+4); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openTestStore(t, path)
+	if _, ok := store.Get("x"); ok {
+		t.Error("Get returned a node that can not be decoded")
+	}
+	if store.Err() == nil {
+		t.Error("Err is nil after reading a node that can not be decoded")
+	}
+	store.Put("y", testLeaf("y"))
+	if len(store.Hashes()) != 1 {
+		t.Error("Put was not ignored after an error")
+	}
+	if err := store.Rewrite(); err == nil {
+		t.Error("Rewrite did not return the error of the store")
+	}
+	if err := store.Close(); err == nil {
+		t.Error("Close did not return the error of the store")
+	}
+
+	if _, err := file.WriteAt([]byte{9}, 0); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if store, err := OpenFileStore(path); err == nil {
+		store.Close()
+		t.Error("OpenFileStore accepted a record of an unknown type")
+	}
+}
+
+// TestFileStoreRewrite deletes a node from a FileStore and checks that Rewrite reclaims its space and keeps the
+// other nodes, also after reopening the file.
+func TestFileStoreRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	store := openTestStore(t, path)
+	store.Put("x", testLeaf("x"))
+	store.Put("y", testLeaf("y"))
+	store.Delete("x")
+	before := fileSize(t, path)
+	if err := store.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	if size := fileSize(t, path); size >= before {
+		t.Errorf("file size is %d after Rewrite, was %d", size, before)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left after Rewrite: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := store.Get("x"); ok {
+			t.Error("deleted node x is still stored")
+		}
+		if node, ok := store.Get("y"); !ok || node.flagValue.value != "y" {
+			t.Errorf("node y read as %v, %v", node, ok)
+		}
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+		store = openTestStore(t, path)
+	}
+	store.Close()
+}
+
+// TestDecodeNodeMalformed checks that decodeNode rejects encodings that are cut short or hold invalid fields.
+func TestDecodeNodeMalformed(t *testing.T) {
+	leaf := testLeaf("v")
+	encodedLeaf := leaf.encode()
+	branch := Node{1, [17]string{}, FlagValue{[]uint8{}, ""}}
+	branch.branchValue[3] = leaf.hashNode()
+	encodedBranch := branch.encode()
+
+	cases := map[string][]byte{
+		"empty":             {},
+		"unknown type":      {9},
+		"truncated branch":  encodedBranch[:10],
+		"truncated child":   encodedBranch[:6],
+		"invalid slot":      append([]byte{1, 2}, encodedBranch[2:]...),
+		"missing value":     encodedBranch[:len(encodedBranch)-4],
+		"truncated path":    encodedLeaf[:5],
+		"invalid path":      {3, 0, 0, 0, 1, 0x50, 0, 0, 0, 1, 'v'},
+		"leaf as extension": append([]byte{2}, encodedLeaf[1:]...),
+		"truncated value":   encodedLeaf[:len(encodedLeaf)-1],
+		"trailing bytes":    append(append([]byte{}, encodedLeaf...), 0),
+	}
+	for name, encoded := range cases {
+		if _, err := decodeNode(encoded); err == nil {
+			t.Errorf("%s: decodeNode accepted %x", name, encoded)
+		}
+	}
+	for _, node := range []Node{branch, leaf} {
+		if decoded, err := decodeNode(node.encode()); err != nil || decoded.hashNode() != node.hashNode() {
+			t.Errorf("%v decoded as %v, %v", node, decoded, err)
+		}
+	}
+}
+
+// TestLoadStoreReleasesOldRoot loads a trie from another RefCountStore and checks that the old root is released
+// from its own store and the new root is retained in the new one.
+func TestLoadStoreReleasesOldRoot(t *testing.T) {
+	mpt, oldStore := refCountTrie()
+	other, newStore := refCountTrie()
+	mpt.Insert("a", "va")
+	other.Insert("b", "vb")
+	if err := mpt.LoadStore(newStore, other.Root); err != nil {
+		t.Fatal(err)
+	}
+	if hashes := oldStore.Hashes(); len(hashes) != 0 {
+		t.Errorf("%d nodes left in the old store", len(hashes))
+	}
+	if refs := newStore.Refs(other.Root); refs != 2 {
+		t.Errorf("new root has %d references, want 2", refs)
+	}
+	if v, err := mpt.Get("b"); err != nil || v != "vb" {
+		t.Errorf("Get(b) = %q, %v", v, err)
+	}
+}
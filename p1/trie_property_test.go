@@ -0,0 +1,244 @@
+package p1
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The functions in this file check MerklePatriciaTrie against a plain Go map with random operations. A failing
+// sequence of operations is shrunk before it is reported, so the error holds a short case that can be replayed
+// with RunTrieOps. TestTrieProperties runs random sequences and FuzzTrieOps lets go test -fuzz generate them.
+
+// TestTrieProperties checks the trie against a map with random operations.
+func TestTrieProperties(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3} {
+		if err := CheckTrie(seed, 50, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// FuzzTrieOps checks the trie against a map with the operations read from the fuzz input by TrieOpsFromBytes.
+func FuzzTrieOps(f *testing.F) {
+	f.Add([]byte("\x00\x01aav\x00\x01abv\x00\x00bv\x01\x01aa"))
+	f.Add([]byte("\x00\x08applicantv\x00\x00av\x01\x00a\x02\x08applicant"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ops := TrieOpsFromBytes(data)
+		if err := RunTrieOps(ops); err != nil {
+			t.Fatalf("%v\nshrunk to %v", err, ShrinkTrieOps(ops))
+		}
+	})
+}
+
+// TrieOp is a single operation applied to a trie. Kind is "insert", "delete" or "get".
+type TrieOp struct {
+	Kind  string `json:"kind"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// String returns the operation as Go code that replays it.
+func (op TrieOp) String() string {
+	switch op.Kind {
+	case "insert":
+		return fmt.Sprintf("mpt.Insert(%q, %q)", op.Key, op.Value)
+	case "delete":
+		return fmt.Sprintf("mpt.Delete(%q)", op.Key)
+	}
+	return fmt.Sprintf("mpt.Get(%q)", op.Key)
+}
+
+// trieKeyParts are the pieces random keys are made of. The long shared prefix and the single byte pieces that
+// differ in only one nibble create long extensions and branches that collapse on delete.
+var trieKeyParts = []string{"applicant", "a", "b", "\x00", "\x01", "\x10", "\xff", "ab", "aa"}
+
+// RandomTrieOps returns n random operations drawn from rng. The keys are built from a few pieces so that they
+// often share long prefixes, and about half of the operations reuse a key that was inserted before.
+func RandomTrieOps(rng *rand.Rand, n int) []TrieOp {
+	ops := make([]TrieOp, 0, n)
+	var used []string
+	for i := 0; i < n; i++ {
+		var key string
+		if len(used) > 0 && rng.Intn(2) == 0 {
+			key = used[rng.Intn(len(used))]
+		} else {
+			parts := 1 + rng.Intn(4)
+			for j := 0; j < parts; j++ {
+				key += trieKeyParts[rng.Intn(len(trieKeyParts))]
+			}
+		}
+		switch r := rng.Intn(10); {
+		case r < 5:
+			ops = append(ops, TrieOp{"insert", key, fmt.Sprintf("v%d", rng.Intn(4))})
+			used = append(used, key)
+		case r < 8:
+			ops = append(ops, TrieOp{"delete", key, ""})
+		default:
+			ops = append(ops, TrieOp{"get", key, ""})
+		}
+	}
+	return ops
+}
+
+// TrieOpsFromBytes turns arbitrary bytes into operations, for use by a fuzz target. Every operation takes a
+// byte for its kind and its key length, then the bytes of the key and a byte for its value.
+func TrieOpsFromBytes(data []byte) []TrieOp {
+	var ops []TrieOp
+	for len(data) >= 2 {
+		kind, keyLength := data[0]%3, int(data[1]%8)+1
+		data = data[2:]
+		if keyLength > len(data) {
+			keyLength = len(data)
+		}
+		key := string(data[:keyLength])
+		data = data[keyLength:]
+		switch {
+		case key == "":
+		case kind == 0 && len(data) > 0:
+			ops = append(ops, TrieOp{"insert", key, fmt.Sprintf("v%d", data[0]%4)})
+			data = data[1:]
+		case kind == 1:
+			ops = append(ops, TrieOp{"delete", key, ""})
+		default:
+			ops = append(ops, TrieOp{"get", key, ""})
+		}
+	}
+	return ops
+}
+
+// RunTrieOps applies ops to a new trie and to a map. After every operation the results, the contents and the
+// integrity of the trie are checked, and the Root is compared against a trie built from the map in a single pass
+// and against the values inserted one by one in reverse order. An error describing the first difference is
+// returned. A panic is returned as an error as well, so that the operations causing it can be shrunk.
+func RunTrieOps(ops []TrieOp) (err error) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	expected := make(map[string]string)
+	i := 0
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("op %d %v: panic: %v", i, ops[i], r)
+		}
+	}()
+	for ; i < len(ops); i++ {
+		op := ops[i]
+		var got, want string
+		switch op.Kind {
+		case "insert":
+			mpt.Insert(op.Key, op.Value)
+			expected[op.Key] = op.Value
+		case "delete":
+			got, _ = mpt.Delete(op.Key)
+			want = expected[op.Key]
+			delete(expected, op.Key)
+		default:
+			got, _ = mpt.Get(op.Key)
+			want = expected[op.Key]
+		}
+		if got != want {
+			return fmt.Errorf("op %d %v: got %q, expected %q", i, op, got, want)
+		}
+		if err := checkTrie(&mpt, expected); err != nil {
+			return fmt.Errorf("op %d %v: %v", i, op, err)
+		}
+	}
+	return nil
+}
+
+// checkTrie compares the contents and the Root of mpt with the values in expected.
+func checkTrie(mpt *MerklePatriciaTrie, expected map[string]string) error {
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if value, _ := mpt.Get(k); value != expected[k] {
+			return fmt.Errorf("get %q returned %q, expected %q", k, value, expected[k])
+		}
+	}
+	it := mpt.Iter()
+	for i := 0; it.Next(); i++ {
+		if i >= len(keys) || it.Key() != keys[i] || it.Value() != expected[keys[i]] {
+			return fmt.Errorf("iteration found %q=%q out of place", it.Key(), it.Value())
+		}
+		keys[i] = ""
+	}
+	for _, k := range keys {
+		if k != "" {
+			return fmt.Errorf("iteration missed %q", k)
+		}
+	}
+	if report := mpt.Verify(); !report.OK() {
+		return fmt.Errorf("integrity check failed: %+v", report)
+	}
+
+	keys = keys[:0]
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = expected[k]
+	}
+	built := MerklePatriciaTrie{}
+	built.Initial()
+	built.BuildSorted(keys, values)
+	if mpt.Root != built.Root {
+		return fmt.Errorf("root %s differs from the built root %s", mpt.Root, built.Root)
+	}
+	reversed := MerklePatriciaTrie{}
+	reversed.Initial()
+	for i := len(keys) - 1; i >= 0; i-- {
+		reversed.Insert(keys[i], values[i])
+	}
+	if mpt.Root != reversed.Root {
+		return fmt.Errorf("root %s differs from the root %s of the reversed insertion order", mpt.Root,
+			reversed.Root)
+	}
+	return nil
+}
+
+// ShrinkTrieOps removes operations from a failing sequence for as long as it keeps failing, first in large
+// chunks and then one at a time. It returns the shortest failing sequence found.
+func ShrinkTrieOps(ops []TrieOp) []TrieOp {
+	if RunTrieOps(ops) == nil {
+		return ops
+	}
+	for chunk := len(ops) / 2; chunk >= 1; chunk /= 2 {
+		for start := 0; start+chunk <= len(ops); {
+			candidate := append(append([]TrieOp{}, ops[:start]...), ops[start+chunk:]...)
+			if RunTrieOps(candidate) != nil {
+				ops = candidate
+			} else {
+				start += chunk
+			}
+		}
+	}
+	return ops
+}
+
+// CheckTrie runs rounds sequences of n random operations seeded by seed. It returns nil if every sequence
+// passed, or an error holding the shrunk operations of the first failure.
+func CheckTrie(seed int64, rounds int, n int) error {
+	rng := rand.New(rand.NewSource(seed))
+	for round := 0; round < rounds; round++ {
+		ops := RandomTrieOps(rng, n)
+		if RunTrieOps(ops) == nil {
+			continue
+		}
+		ops = ShrinkTrieOps(ops)
+		replay := make([]string, len(ops))
+		for i, op := range ops {
+			replay[i] = op.String()
+		}
+		return fmt.Errorf("round %d of seed %d failed: %v\n%s", round, seed, RunTrieOps(ops),
+			strings.Join(replay, "\n"))
+	}
+	return nil
+}
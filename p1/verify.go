@@ -0,0 +1,187 @@
+package p1
+
+import (
+	"sort"
+)
+
+// TrieStats describes the shape of a MerklePatriciaTrie.
+type TrieStats struct {
+	// Branches, Extensions and Leaves count the distinct nodes reachable from Root by type.
+	Branches   int `json:"branches"`
+	Extensions int `json:"extensions"`
+	Leaves     int `json:"leaves"`
+	// Values is the number of keys stored in the trie.
+	Values int `json:"values"`
+	// Depths maps a depth to the number of keys whose value is found in a node at that depth. The root is at
+	// depth 1.
+	Depths map[int]int `json:"depths"`
+	// Bytes is the total size of the canonical encoding of the distinct nodes reachable from Root.
+	Bytes int `json:"bytes"`
+}
+
+// TrieReport lists the problems found by Verify. Each entry is a node hash, or a key for the value lists.
+type TrieReport struct {
+	// BadHashes are nodes whose content does not hash to the hash they are stored under.
+	BadHashes []string `json:"badHashes"`
+	// Dangling are hashes referenced by a node but missing from the store.
+	Dangling []string `json:"dangling"`
+	// Malformed are nodes that break the shape of the trie, such as a branch with a single entry or an
+	// extension that does not lead to a branch.
+	Malformed []string `json:"malformed"`
+	// Orphans are stored nodes that are not reachable from Root. Updates and snapshots leave these behind,
+	// so they are not a sign of corruption. Only VerifyStore searches for them.
+	Orphans []string `json:"orphans"`
+	// MissingValues are keys in Values.Db whose value is not found in the trie.
+	MissingValues []string `json:"missingValues"`
+	// ExtraValues are keys found in the trie but not in Values.Db.
+	ExtraValues []string `json:"extraValues"`
+	// ChangedValues are keys found in both the trie and Values.Db with a different value.
+	ChangedValues []string `json:"changedValues"`
+}
+
+// OK tests if the report found no corruption. Orphans are not counted.
+func (report TrieReport) OK() bool {
+	return len(report.BadHashes) == 0 && len(report.Dangling) == 0 && len(report.Malformed) == 0 &&
+		len(report.MissingValues) == 0 && len(report.ExtraValues) == 0 && len(report.ChangedValues) == 0
+}
+
+// Stats walks the trie from Root and returns its TrieStats.
+func (mpt *MerklePatriciaTrie) Stats() TrieStats {
+	stats := TrieStats{Depths: make(map[int]int)}
+	if mpt.Root == "" || mpt.db == nil {
+		return stats
+	}
+	seen := make(map[string]bool)
+	mpt.recurseStats(mpt.Root, 1, seen, &stats)
+	return stats
+}
+
+// recurseStats adds the node under hash at the given depth and everything below it to stats.
+func (mpt *MerklePatriciaTrie) recurseStats(hash string, depth int, seen map[string]bool, stats *TrieStats) {
+	node, ok := mpt.db.Get(hash)
+	if !ok {
+		return
+	}
+	if !seen[hash] {
+		seen[hash] = true
+		stats.Bytes += len(node.encode())
+		if node.nodeType == 1 {
+			stats.Branches++
+		} else if isExtNode(node.flagValue.encodedPrefix) {
+			stats.Extensions++
+		} else {
+			stats.Leaves++
+		}
+	}
+	if (node.nodeType == 1 && node.branchValue[16] != "") ||
+		(node.nodeType == 2 && !isExtNode(node.flagValue.encodedPrefix)) {
+		stats.Values++
+		stats.Depths[depth]++
+	}
+	for _, child := range node.children() {
+		mpt.recurseStats(child, depth+1, seen, stats)
+	}
+}
+
+// Verify checks the integrity of the trie. Every node reachable from Root is rehashed from the leaves up and
+// checked for dangling references and a valid shape, and the values in the trie are compared against Values.Db.
+// Every list in the report is sorted. Only the nodes reachable from Root are read, so the cost does not depend on
+// the size of the store.
+func (mpt *MerklePatriciaTrie) Verify() TrieReport {
+	return mpt.verify(false)
+}
+
+// VerifyStore checks the trie like Verify and also searches the whole store for orphaned nodes.
+func (mpt *MerklePatriciaTrie) VerifyStore() TrieReport {
+	return mpt.verify(true)
+}
+
+// verify builds the report of Verify. The store is only searched for orphaned nodes if orphans is true.
+func (mpt *MerklePatriciaTrie) verify(orphans bool) TrieReport {
+	report := TrieReport{}
+	reachable := make(map[string]bool)
+	if mpt.Root != "" && mpt.db != nil {
+		if _, ok := mpt.db.Get(mpt.Root); ok {
+			mpt.recurseVerify(mpt.Root, reachable, &report)
+		} else {
+			report.Dangling = append(report.Dangling, mpt.Root)
+		}
+	}
+	if orphans && mpt.db != nil {
+		for _, hash := range mpt.db.Hashes() {
+			if !reachable[hash] {
+				report.Orphans = append(report.Orphans, hash)
+			}
+		}
+	}
+
+	found := make(map[string]bool)
+	it := mpt.Iter()
+	for it.Next() {
+		found[it.Key()] = true
+		if value, ok := mpt.Values.Db[it.Key()]; !ok {
+			report.ExtraValues = append(report.ExtraValues, it.Key())
+		} else if value != it.Value() {
+			report.ChangedValues = append(report.ChangedValues, it.Key())
+		}
+	}
+	for k := range mpt.Values.Db {
+		if !found[k] {
+			report.MissingValues = append(report.MissingValues, k)
+		}
+	}
+
+	for _, list := range [][]string{report.BadHashes, report.Dangling, report.Malformed, report.Orphans,
+		report.MissingValues, report.ExtraValues, report.ChangedValues} {
+		sort.Strings(list)
+	}
+	return report
+}
+
+// recurseVerify checks the children of the node under hash before the node itself. reachable collects every
+// hash that was visited.
+func (mpt *MerklePatriciaTrie) recurseVerify(hash string, reachable map[string]bool, report *TrieReport) {
+	if reachable[hash] {
+		return
+	}
+	reachable[hash] = true
+	node, _ := mpt.db.Get(hash)
+	for _, child := range node.children() {
+		if _, ok := mpt.db.Get(child); !ok {
+			report.Dangling = append(report.Dangling, child)
+			continue
+		}
+		mpt.recurseVerify(child, reachable, report)
+	}
+	if node.hashNode() != hash {
+		report.BadHashes = append(report.BadHashes, hash)
+	}
+	if !mpt.wellFormed(node) {
+		report.Malformed = append(report.Malformed, hash)
+	}
+}
+
+// wellFormed tests if node has a valid shape: a branch holds at least two entries, an extension has a path and
+// leads to a branch, and a leaf holds a value.
+func (mpt *MerklePatriciaTrie) wellFormed(node Node) bool {
+	switch node.nodeType {
+	case 1:
+		entries := 0
+		for _, v := range node.branchValue {
+			if v != "" {
+				entries++
+			}
+		}
+		return entries >= 2
+	case 2:
+		if !validPrefix(node.flagValue.encodedPrefix) {
+			return false
+		}
+		if isExtNode(node.flagValue.encodedPrefix) {
+			next, _ := mpt.db.Get(node.flagValue.value)
+			return len(compactDecode(node.flagValue.encodedPrefix)) > 0 && next.nodeType != 2
+		}
+		return node.flagValue.value != ""
+	}
+	return false
+}
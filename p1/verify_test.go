@@ -0,0 +1,43 @@
+package p1
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestVerifyValues checks that Verify reports keys missing from, only in or different between the trie and
+// Values.Db each under their own list.
+func TestVerifyValues(t *testing.T) {
+	mpt := insertKeys([]string{"do", "dog", "horse"})
+	delete(mpt.Values.Db, "do")
+	mpt.Values.Db["dog"] = "cat"
+	mpt.Values.Db["doge"] = "vdoge"
+	report := mpt.Verify()
+	want := TrieReport{
+		MissingValues: []string{"doge"},
+		ExtraValues:   []string{"do"},
+		ChangedValues: []string{"dog"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("Verify = %+v, want %+v", report, want)
+	}
+	if report.OK() {
+		t.Error("report with mismatched values is OK")
+	}
+}
+
+// TestVerifyStoreOrphans checks that only VerifyStore searches the store for orphaned nodes.
+func TestVerifyStoreOrphans(t *testing.T) {
+	mpt := insertKeys([]string{"do", "dog"})
+	mpt.Insert("dog", "cat")
+	if report := mpt.Verify(); len(report.Orphans) != 0 {
+		t.Errorf("Verify searched the store and found orphans %v", report.Orphans)
+	}
+	report := mpt.VerifyStore()
+	if len(report.Orphans) == 0 {
+		t.Error("VerifyStore found no orphans after replacing a value")
+	}
+	if !report.OK() {
+		t.Errorf("orphans made the report fail: %+v", report)
+	}
+}
@@ -0,0 +1,113 @@
+package p1
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dot exports the nodes reachable from Root as a Graphviz DOT graph. Every node is drawn once, labeled with its
+// type, the start of its hash, its decoded nibble path and its value. Edges from a branch are labeled with their
+// nibble. Render it with `dot -Tsvg`.
+func (mpt *MerklePatriciaTrie) Dot() string {
+	var sb strings.Builder
+	sb.WriteString("digraph trie {\n\tnode [shape=box, fontname=monospace];\n")
+	if mpt.Root != "" && mpt.db != nil {
+		seen := make(map[string]bool)
+		queue := []string{mpt.Root}
+		for len(queue) != 0 {
+			hash := queue[0]
+			queue = queue[1:]
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			node := mpt.getNode(hash)
+			fmt.Fprintf(&sb, "\t%q [label=%q];\n", hash, node.viewLabel(hash, "\n"))
+			if node.nodeType == 1 {
+				for i, child := range node.branchValue[:16] {
+					if child != "" {
+						fmt.Fprintf(&sb, "\t%q -> %q [label=\"%x\"];\n", hash, child, i)
+						queue = append(queue, child)
+					}
+				}
+			} else if node.nodeType == 2 && isExtNode(node.flagValue.encodedPrefix) {
+				fmt.Fprintf(&sb, "\t%q -> %q;\n", hash, node.flagValue.value)
+				queue = append(queue, node.flagValue.value)
+			}
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Tree exports the trie as an indented ASCII tree. Every line shows the nibble a node is reached by, its type,
+// its decoded nibble path, its value and the start of its hash. Nodes shared by several parents are repeated.
+func (mpt *MerklePatriciaTrie) Tree() string {
+	var sb strings.Builder
+	if mpt.Root == "" || mpt.db == nil {
+		return "(empty)\n"
+	}
+	mpt.recurseTree(&sb, mpt.Root, "", "", "")
+	return sb.String()
+}
+
+// recurseTree writes the node under hash and the nodes below it to sb. label is written before the node, and
+// indent before each of the lines for its children.
+func (mpt *MerklePatriciaTrie) recurseTree(sb *strings.Builder, hash string, label string, prefix string,
+	indent string) {
+	node := mpt.getNode(hash)
+	fmt.Fprintf(sb, "%s%s%s\n", prefix, label, node.viewLabel(hash, " "))
+	var children []string
+	var labels []string
+	if node.nodeType == 1 {
+		for i, child := range node.branchValue[:16] {
+			if child != "" {
+				children = append(children, child)
+				labels = append(labels, fmt.Sprintf("%x: ", i))
+			}
+		}
+	} else if node.nodeType == 2 && isExtNode(node.flagValue.encodedPrefix) {
+		children = append(children, node.flagValue.value)
+		labels = append(labels, "")
+	}
+	for i, child := range children {
+		if i == len(children)-1 {
+			mpt.recurseTree(sb, child, labels[i], indent+"└─ ", indent+"   ")
+		} else {
+			mpt.recurseTree(sb, child, labels[i], indent+"├─ ", indent+"│  ")
+		}
+	}
+}
+
+// viewLabel describes node, stored under hash, for Dot and Tree. The parts of the description are joined by sep.
+func (node *Node) viewLabel(hash string, sep string) string {
+	short := hash
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	switch node.nodeType {
+	case 1:
+		parts := []string{"branch", short}
+		if node.branchValue[16] != "" {
+			parts = append(parts, fmt.Sprintf("value=%q", node.branchValue[16]))
+		}
+		return strings.Join(parts, sep)
+	case 2:
+		path := nibblesToString(compactDecode(node.flagValue.encodedPrefix))
+		if isExtNode(node.flagValue.encodedPrefix) {
+			return strings.Join([]string{"ext", short, "path=" + path}, sep)
+		}
+		return strings.Join([]string{"leaf", short, "path=" + path, fmt.Sprintf("value=%q", node.flagValue.value)},
+			sep)
+	}
+	return "missing " + short
+}
+
+// nibblesToString writes every nibble of a hex array as a hexadecimal digit.
+func nibblesToString(hexArr []uint8) string {
+	var sb strings.Builder
+	for _, v := range hexArr {
+		fmt.Fprintf(&sb, "%x", v)
+	}
+	return sb.String()
+}
@@ -1,6 +1,7 @@
 package p2
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -27,14 +28,28 @@ type Header struct {
 	Timestamp  int64  `json:"timeStamp"`
 	Height     int32  `json:"height"`
 	ParentHash string `json:"parentHash"`
+	// AcceptRoot and ApplyRoot are the roots of the acceptance and application tries, so that the header can be
+	// hashed on its own
+	AcceptRoot string `json:"acceptRoot"`
+	ApplyRoot  string `json:"applyRoot"`
 	// Size is the size of the two mpt added together
 	Size int32 `json:"size"`
+	// Difficulty is the number of leading zero bits of Hash, and Nonce was chosen by Mine to reach it
+	Difficulty uint32 `json:"difficulty"`
+	Nonce      uint64 `json:"nonce"`
+	// Proposer is the ID of the validator that signed Hash with Signature under ProofOfAuthority
+	Proposer  string `json:"proposer,omitempty"`
+	Signature string `json:"signature,omitempty"`
 }
 
 // BlockChain contains the highest length of the BlockChain and the Chain of the blockchain.
 type BlockChain struct {
 	Chain  map[int32][]Block
 	Length int32
+	// reorgHandlers are called when the canonical chain changes, see OnReorg
+	reorgHandlers []func(reorg Reorg)
+	// consensus produces and accepts blocks, see SetConsensus
+	consensus Consensus
 }
 
 // NewBlockChain returns a new blockchain
@@ -43,35 +58,42 @@ func NewBlockChain() BlockChain {
 }
 
 // Initial is the constructor for Block. The timestamp is taken at creation time. It is assumed that proper care
-// will be taken to match the parentHash to the corresponding parent.
+// will be taken to match the parentHash to the corresponding parent. The block keeps its own copies of the tries,
+// so later changes to acceptValue and applyValue do not alter it.
 func (blk *Block) Initial(height int32, parentHash string, acceptValue p1.MerklePatriciaTrie,
 	applyValue p1.MerklePatriciaTrie) error {
-	timeStamp := time.Now().Unix()
-	size := int32(len([]byte(fmt.Sprint(acceptValue))) + len([]byte(fmt.Sprint(applyValue))))
-	blk.Header = Header{hashString(string(height) + string(timeStamp) + parentHash + acceptValue.Root +
-		applyValue.Root + string(size)), timeStamp, height, parentHash, size}
-	blk.AcceptValue = acceptValue
-	blk.ApplyValue = applyValue
-	return nil
+	return blk.NewBlock(height, time.Now().Unix(), parentHash, acceptValue, applyValue)
 }
 
 // NewBlock is a special constructor for Block that allows for a manual input for the timestamp.
-// This is useful for test applications.
+// This is useful for test applications. The block still has to be sealed with BlockChain.Seal.
 func (blk *Block) NewBlock(height int32, timeStamp int64, parentHash string, acceptValue p1.MerklePatriciaTrie,
 	applyValue p1.MerklePatriciaTrie) error {
-	size := int32(len([]byte(fmt.Sprint(acceptValue))) + len([]byte(fmt.Sprint(applyValue))))
-	blk.Header = Header{hashString(string(height) + string(timeStamp) + parentHash + acceptValue.Root +
-		applyValue.Root + string(size)), timeStamp, height, parentHash, size}
-	blk.AcceptValue = acceptValue
-	blk.ApplyValue = applyValue
+	blk.Header = Header{Timestamp: timeStamp, Height: height, ParentHash: parentHash,
+		AcceptRoot: acceptValue.Root, ApplyRoot: applyValue.Root, Size: computeSize(acceptValue, applyValue),
+		Difficulty: Difficulty}
+	blk.AcceptValue = acceptValue.CloneShared()
+	blk.ApplyValue = applyValue.CloneShared()
+	blk.Header.Hash = blk.Header.ComputeHash()
 	return nil
 }
 
-// DecodeFromJson decodes a JSON string into blk.
-// An error is returned if json.Unmarshal is unable to decode the string.
+// computeSize returns the size of two tries added together: the length of the canonical encoding of their nodes.
+func computeSize(acceptValue p1.MerklePatriciaTrie, applyValue p1.MerklePatriciaTrie) int32 {
+	return int32(acceptValue.Stats().Bytes + applyValue.Stats().Bytes)
+}
+
+// DecodeFromJson decodes a JSON string into blk. The tries of the block are rebuilt from their values.
+// An error is returned if json.Unmarshal is unable to decode the string or if a rebuilt trie does not match
+// the root it was serialized with. blk is left unchanged on error.
 func (blk *Block) DecodeFromJson(jsonString string) error {
-	err := json.Unmarshal([]byte(jsonString), &blk)
-	return err
+	decoded := Block{}
+	err := json.Unmarshal([]byte(jsonString), &decoded)
+	if err != nil {
+		return err
+	}
+	*blk = decoded
+	return nil
 }
 
 // EncodeToJson encodes a block to a JSON string. This string is returned.
@@ -84,7 +106,8 @@ func (blk *Block) EncodeToJson() (string, error) {
 	return string(res), nil
 }
 
-// Get returns the list of Blocks at height level in the blockchain.
+// Get returns the list of Blocks at height level in the blockchain. The list holds the block of every fork at that
+// height; use CanonicalBlock for the block of the canonical chain.
 func (bc *BlockChain) Get(height int32) []Block {
 	if bc.Chain == nil || bc.Length < height || height < 0 {
 		return nil
@@ -92,44 +115,56 @@ func (bc *BlockChain) Get(height int32) []Block {
 	return bc.Chain[height-1]
 }
 
-// Insert inserts block into the BlockChain.
-// FIXME: In the current state, there is no input validation for the inserted Blocks to verify if it does create a valid
-//        blockchain.
+// Insert inserts block into the BlockChain. The block is checked by ValidateBlock first, and the error it returns
+// is passed on if the block is rejected.
 func (bc *BlockChain) Insert(block Block) error {
 	if bc.Chain == nil {
 		bc.Chain = make(map[int32][]Block)
 		bc.Length = 0
-	} else if block.Header.Height < 0 {
-		return errors.New("height out of range")
-	}
-
-	// FIXME: This intuitively makes more sense to include this, otherwise there may be
-	//        an improper block that does not connect to a parent hash.
-	// TODO: This is if we want to restrict the blockchain to not take blocks that
-	//       have a height larger than the length of the blockchain
-	//if bc.Length+1 < block.Header.Height {
-	//	return errors.New("invalid height")
-	//}
-	//fmt.Printf("Trying to add %s to %+v\n", block.Header.Hash, bc.Chain[block.Header.Height-1])
-	for _, v := range bc.Chain[block.Header.Height-1] {
-		if v.Header.Hash == block.Header.Hash {
-			//fmt.Printf("Unable to add %s to %+v\n", block.Header.Hash, bc.Chain[block.Header.Height-1])
-			return errors.New("duplicate block")
-		}
 	}
-	//fmt.Printf("Able to add %s to %+v\n", block.Header.Hash, bc.Chain[block.Header.Height-1])
+	if err := bc.ValidateBlock(block); err != nil {
+		return err
+	}
+	oldChain := bc.canonicalIfWatched()
 	bc.Chain[block.Header.Height-1] = append(bc.Chain[block.Header.Height-1], block)
 	if block.Header.Height > bc.Length {
 		bc.Length = block.Header.Height
 	}
+	bc.emitReorg(oldChain)
 	return nil
 }
 
-// DecodeFromJson decodes jsonString into the bc BlockChain.
-// An error is thrown if json.UnMarshal could not decode the string.
+// DecodeFromJson decodes jsonString into the bc BlockChain. The tries of every block are rebuilt from their values,
+// and the blocks are inserted into a new chain in height order, so that every block passes ValidateBlock under the
+// Consensus of bc. An error is thrown if json.UnMarshal could not decode the string or if any rebuilt trie does not
+// match the root it was serialized with, and the *BlockError of the first rejected block is returned. bc is left
+// unchanged on error. The Consensus of bc and the handlers registered with OnReorg are kept, and the handlers are
+// called if the canonical chain changes.
 func (bc *BlockChain) DecodeFromJson(jsonString string) error {
-	err := json.Unmarshal([]byte(jsonString), &bc)
-	return err
+	decoded := NewBlockChain()
+	err := json.Unmarshal([]byte(jsonString), &decoded)
+	if err != nil {
+		return err
+	}
+	heights := make([]int, 0, len(decoded.Chain))
+	for index := range decoded.Chain {
+		heights = append(heights, int(index))
+	}
+	sort.Ints(heights)
+	validated := NewBlockChain()
+	validated.consensus = bc.consensus
+	for _, index := range heights {
+		for _, block := range decoded.Chain[int32(index)] {
+			if err := validated.Insert(block); err != nil {
+				return err
+			}
+		}
+	}
+	oldChain := bc.canonicalIfWatched()
+	validated.reorgHandlers = bc.reorgHandlers
+	*bc = validated
+	bc.emitReorg(oldChain)
+	return nil
 }
 
 // EncodeToJson encodes the blockchain bc to a JSON string. This string is returned.
@@ -142,34 +177,53 @@ func (bc *BlockChain) EncodeToJson() (string, error) {
 	return string(resp), nil
 }
 
+// ShowAcceptances returns the accepted UID of every company. The blocks of the canonical chain are visited from
+// the lowest height up, so a later acceptance by the same company replaces an earlier one.
 func (bc *BlockChain) ShowAcceptances() map[string]int32 {
 	acc := make(map[string]int32)
 
-	for _, v := range bc.Chain {
-		blk := v[0]
-		for k2, v2 := range blk.AcceptValue.Values.Db {
-			uid, err := strconv.Atoi(v2)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Could not show %s accept with %s\n", k2, v2)
-				continue
-			}
-			acc[k2] = int32(uid)
+	for _, blk := range bc.CanonicalChain() {
+		for company, uid := range blk.Acceptances() {
+			acc[company] = uid
 		}
 	}
 
 	return acc
 }
 
+// ShowApplications returns every application on the canonical chain, ordered by height and then by key.
 func (bc *BlockChain) ShowApplications() []string {
 	var merits []string
 
-	for _, v := range bc.Chain {
-		blk := v[0]
-		for _, v2 := range blk.ApplyValue.Values.Db {
-			merits = append(merits, v2)
+	for _, blk := range bc.CanonicalChain() {
+		merits = append(merits, blk.Applications()...)
+	}
+
+	return merits
+}
+
+// Acceptances returns the accepted UID of every company in blk. Acceptances that are not a number are skipped.
+func (blk *Block) Acceptances() map[string]int32 {
+	acc := make(map[string]int32)
+	it := blk.AcceptValue.Iter()
+	for it.Next() {
+		uid, err := strconv.Atoi(it.Value())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not show %s accept with %s\n", it.Key(), it.Value())
+			continue
 		}
+		acc[it.Key()] = int32(uid)
 	}
+	return acc
+}
 
+// Applications returns every application in blk, ordered by key.
+func (blk *Block) Applications() []string {
+	var merits []string
+	it := blk.ApplyValue.Iter()
+	for it.Next() {
+		merits = append(merits, it.Value())
+	}
 	return merits
 }
 
@@ -183,28 +237,26 @@ func constructMpt(mptMap map[string]string) p1.MerklePatriciaTrie {
 	return mpt
 }
 
-// hashString hashes the given string. The hashed string is returned.
-func hashString(str string) string {
-	sum := sha3.Sum256([]byte(str))
-	return hex.EncodeToString(sum[:])
-}
-
-// GenBlock generates the next block at the next height
-func (bc *BlockChain) GenBlock(acceptMpt p1.MerklePatriciaTrie, applyMpt p1.MerklePatriciaTrie) (Block, error) {
-	if bc.Length == 0 || len(bc.Chain[bc.Length-1]) == 0 {
-		return Block{}, errors.New("missing parent")
-	}
+// GenBlock generates the next block on top of the head of the canonical chain, or the first block of an empty chain,
+// seals it with the Consensus of bc under ctx and inserts it. The error of Seal or Insert is returned, so mining
+// stops once ctx is done and a block that ValidateBlock rejects is not added.
+func (bc *BlockChain) GenBlock(ctx context.Context, acceptMpt p1.MerklePatriciaTrie,
+	applyMpt p1.MerklePatriciaTrie) (Block, error) {
+	parent, _ := bc.Head()
 	block := Block{}
-	block.Initial(bc.Length+1, bc.Chain[bc.Length-1][0].Header.Hash, acceptMpt, applyMpt)
-	//fmt.Printf("Able to add %s to %+v\n", block.Header.Hash, bc.Chain[block.Header.Height-1])
-	bc.Chain[bc.Length] = append(bc.Chain[bc.Length], block)
-	bc.Length++
+	block.Initial(parent.Header.Height+1, parent.Header.Hash, acceptMpt, applyMpt)
+	if err := bc.Seal(ctx, &block, parent); err != nil {
+		return Block{}, err
+	}
+	if err := bc.Insert(block); err != nil {
+		return Block{}, err
+	}
 	return block, nil
 }
 
-// GetHighest returns the list of blocks at the highest height
-func (bc *BlockChain) GetHighest() ([]Block, error) {
-	fmt.Println(bc.Length)
+// GetHighestForks returns the list of blocks at the highest height, across every fork. The canonical chain may end
+// below that height if a lower fork holds more work; use Head for the last block of the canonical chain.
+func (bc *BlockChain) GetHighestForks() ([]Block, error) {
 	if bc.Length > 0 {
 		return bc.Chain[bc.Length-1], nil
 	} else {
@@ -212,9 +264,9 @@ func (bc *BlockChain) GetHighest() ([]Block, error) {
 	}
 }
 
-// CheckParentHash adds the block to the blockchain if the parent exists,
-// otherwise false is returned.
-func (bc *BlockChain) CheckParentHash(insertBlock Block) bool {
+// InsertOnKnownParent adds the block to the blockchain if its parent is stored on any fork, otherwise false is
+// returned. The block does not have to extend the canonical chain; Head picks the canonical chain afterwards.
+func (bc *BlockChain) InsertOnKnownParent(insertBlock Block) bool {
 	if bc.Length == 0 || insertBlock.Header.Height < 2 || len(bc.Chain[insertBlock.Header.Height-2]) == 0 {
 		return false
 	}
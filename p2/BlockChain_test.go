@@ -0,0 +1,101 @@
+package p2
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testChain returns a chain of n mined blocks.
+func testChain(t *testing.T, n int) BlockChain {
+	bc := NewBlockChain()
+	parent := Block{}
+	for i := 1; i <= n; i++ {
+		block := Block{}
+		block.NewBlock(int32(i), int64(100+i), parent.Header.Hash, testTrie(), testTrie("uid", string(rune('a'+i))))
+		if err := bc.Seal(context.Background(), &block, parent); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.Insert(block); err != nil {
+			t.Fatal(err)
+		}
+		parent = block
+	}
+	return bc
+}
+
+// TestDecodeValidatesChain checks that a decoded chain replaces bc only if every block in it is valid under the
+// Consensus of bc.
+func TestDecodeValidatesChain(t *testing.T) {
+	withDifficulty(t, 4)
+	source := testChain(t, 3)
+	encoded, err := source.EncodeToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := NewBlockChain()
+	if err := bc.DecodeFromJson(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if head, _ := bc.Head(); head.Header.Height != 3 {
+		t.Fatalf("decoded head is at height %d", head.Header.Height)
+	}
+
+	forged := NewBlockChain()
+	for index, blocks := range source.Chain {
+		forged.Chain[index] = append([]Block{}, blocks...)
+	}
+	forged.Length = source.Length
+	unmined := &forged.Chain[1][0]
+	unmined.Header.Nonce++
+	unmined.Header.Hash = unmined.Header.ComputeHash()
+	forgedJson, err := forged.EncodeToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.DecodeFromJson(forgedJson); !errors.Is(err, ErrBadWork) {
+		t.Errorf("chain with an unmined block: got %v, expected %v", err, ErrBadWork)
+	}
+	if head, _ := bc.Head(); head.Header.Hash != source.Chain[2][0].Header.Hash {
+		t.Errorf("a rejected chain replaced the chain")
+	}
+
+	authority := NewBlockChain()
+	authority.SetConsensus(&ProofOfAuthority{})
+	if err := authority.DecodeFromJson(encoded); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned chain under proof-of-authority: got %v, expected %v", err, ErrUnsigned)
+	}
+	if _, ok := authority.Head(); ok {
+		t.Errorf("a rejected chain replaced the chain")
+	}
+}
+
+// TestGenBlock checks that GenBlock inserts sealed blocks on top of the head, and that it stops and inserts nothing
+// once its context is done.
+func TestGenBlock(t *testing.T) {
+	withDifficulty(t, 4)
+	bc := NewBlockChain()
+	first, err := bc.GenBlock(context.Background(), testTrie(), testTrie("uid", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := bc.GenBlock(context.Background(), testTrie(), testTrie("uid", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Header.Height != 1 || second.Header.Height != 2 || second.Header.ParentHash != first.Header.Hash {
+		t.Fatalf("generated blocks at heights %d and %d", first.Header.Height, second.Header.Height)
+	}
+	if head, _ := bc.Head(); head.Header.Hash != second.Header.Hash {
+		t.Fatal("generated block is not the head")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bc.GenBlock(ctx, testTrie(), testTrie("uid", "c")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GenBlock with a cancelled context returned %v", err)
+	}
+	if bc.Length != 2 {
+		t.Fatalf("chain has length %d after a cancelled GenBlock", bc.Length)
+	}
+}
@@ -0,0 +1,40 @@
+package p2
+
+import (
+	"context"
+)
+
+// Consensus decides how blocks are produced and which blocks are accepted. A BlockChain uses ProofOfWork unless
+// another Consensus is set with SetConsensus, and every node of a network has to use the same one.
+type Consensus interface {
+	// Prepare sets the consensus fields of block, which is built on top of parent. parent is an empty Block if
+	// block is at height 1.
+	Prepare(bc *BlockChain, block *Block, parent Block)
+	// Seal finishes block so that it passes Verify, and sets its Hash. It stops early with an error if block
+	// cannot be sealed or once ctx is done.
+	Seal(ctx context.Context, block *Block) error
+	// Verify checks the consensus fields of block, whose parent is parent. parent is an empty Block if block is at
+	// height 1. The hash of block already matches its header.
+	Verify(bc *BlockChain, block Block, parent Block) error
+}
+
+// SetConsensus makes bc produce and accept blocks according to consensus.
+func (bc *BlockChain) SetConsensus(consensus Consensus) {
+	bc.consensus = consensus
+}
+
+// Consensus returns the Consensus bc produces and accepts blocks with.
+func (bc *BlockChain) Consensus() Consensus {
+	if bc.consensus == nil {
+		return ProofOfWork{}
+	}
+	return bc.consensus
+}
+
+// Seal prepares block on top of parent and seals it with the Consensus of bc. parent is an empty Block if block is
+// at height 1.
+func (bc *BlockChain) Seal(ctx context.Context, block *Block, parent Block) error {
+	consensus := bc.Consensus()
+	consensus.Prepare(bc, block, parent)
+	return consensus.Seal(ctx, block)
+}
@@ -0,0 +1,70 @@
+package p2
+
+import "math/big"
+
+// The chain may hold several forks. The canonical chain is the one with the most work: under ProofOfWork a block
+// adds 2^Difficulty to the work of its parent, so a fork cannot win by retargeting its difficulty down and
+// growing long and cheap. Under any other Consensus every block adds one, which makes the longest chain
+// canonical. When several chains have the same work, the one whose last block has the lowest hash wins, so every
+// node that holds the same blocks picks the same chain.
+
+// Head returns the last block of the canonical chain, and false if the chain is empty.
+func (bc *BlockChain) Head() (Block, bool) {
+	var head Block
+	var headWork *big.Int
+	work := make(map[string]*big.Int)
+	for height := int32(1); height <= bc.Length; height++ {
+		for _, block := range bc.Chain[height-1] {
+			total := bc.blockWork(block)
+			if parentWork, ok := work[block.Header.ParentHash]; ok && height > 1 {
+				total.Add(total, parentWork)
+			}
+			work[block.Header.Hash] = total
+			if headWork == nil || total.Cmp(headWork) > 0 ||
+				(total.Cmp(headWork) == 0 && block.Header.Hash < head.Header.Hash) {
+				head, headWork = block, total
+			}
+		}
+	}
+	return head, headWork != nil
+}
+
+// blockWork returns the work block adds to the chain: 2^Difficulty under ProofOfWork and 1 otherwise.
+func (bc *BlockChain) blockWork(block Block) *big.Int {
+	if _, ok := bc.Consensus().(ProofOfWork); !ok {
+		return big.NewInt(1)
+	}
+	return new(big.Int).Lsh(big.NewInt(1), uint(block.Header.Difficulty))
+}
+
+// CanonicalChain returns the blocks of the canonical chain ordered from the lowest height up. The chain is
+// followed from Head through the parent hashes, and ends early if a parent is missing.
+func (bc *BlockChain) CanonicalChain() []Block {
+	head, ok := bc.Head()
+	if !ok {
+		return nil
+	}
+	chain := []Block{head}
+	for block := head; block.Header.Height > 1; {
+		parent, ok := bc.findBlock(block.Header.Height-1, block.Header.ParentHash)
+		if !ok {
+			break
+		}
+		chain = append(chain, parent)
+		block = parent
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// CanonicalBlock returns the block of the canonical chain at height, and false if there is none.
+func (bc *BlockChain) CanonicalBlock(height int32) (Block, bool) {
+	for _, block := range bc.CanonicalChain() {
+		if block.Header.Height == height {
+			return block, true
+		}
+	}
+	return Block{}, false
+}
@@ -0,0 +1,49 @@
+package p2
+
+import "testing"
+
+// addForkBlock adds a block with the given header fields to bc without validating it.
+func addForkBlock(bc *BlockChain, height int32, hash string, parentHash string, difficulty uint32) {
+	block := Block{Header: Header{Height: height, Hash: hash, ParentHash: parentHash, Difficulty: difficulty}}
+	bc.Chain[height-1] = append(bc.Chain[height-1], block)
+	if height > bc.Length {
+		bc.Length = height
+	}
+}
+
+// TestHeadPicksMostWork checks that under proof-of-work a short fork with more work wins over a longer one with
+// less, and that the lowest hash breaks a tie.
+func TestHeadPicksMostWork(t *testing.T) {
+	bc := NewBlockChain()
+	addForkBlock(&bc, 1, "g", "", 4)
+	addForkBlock(&bc, 2, "heavy", "g", 8)
+	addForkBlock(&bc, 2, "light1", "g", 2)
+	addForkBlock(&bc, 3, "light2", "light1", 2)
+	addForkBlock(&bc, 4, "light3", "light2", 2)
+	if head, _ := bc.Head(); head.Header.Hash != "heavy" {
+		t.Errorf("head is %s, expected heavy", head.Header.Hash)
+	}
+	chain := bc.CanonicalChain()
+	if len(chain) != 2 || chain[0].Header.Hash != "g" {
+		t.Errorf("canonical chain is %v", chain)
+	}
+
+	addForkBlock(&bc, 2, "even", "g", 8)
+	if head, _ := bc.Head(); head.Header.Hash != "even" {
+		t.Errorf("head is %s, expected the lower hash even", head.Header.Hash)
+	}
+}
+
+// TestHeadPicksLongestWithoutWork checks that every block counts the same under a Consensus other than
+// proof-of-work, so that the longest chain wins.
+func TestHeadPicksLongestWithoutWork(t *testing.T) {
+	bc := NewBlockChain()
+	bc.SetConsensus(&ProofOfAuthority{})
+	addForkBlock(&bc, 1, "g", "", 0)
+	addForkBlock(&bc, 2, "a", "g", 8)
+	addForkBlock(&bc, 2, "b", "g", 0)
+	addForkBlock(&bc, 3, "c", "b", 0)
+	if head, _ := bc.Head(); head.Header.Hash != "c" {
+		t.Errorf("head is %s, expected c", head.Header.Hash)
+	}
+}
@@ -0,0 +1,81 @@
+package p2
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Canonical header encoding
+//
+// The hash of a block is computed over the canonical encoding of its header, which is the fields below in this
+// order:
+//
+//	version:    1 byte, HeaderVersion
+//	height:     4 byte big-endian signed integer
+//	timeStamp:  8 byte big-endian signed integer
+//	parentHash: bytes(parentHash)
+//	acceptRoot: bytes(acceptRoot)
+//	applyRoot:  bytes(applyRoot)
+//	size:       4 byte big-endian signed integer
+//	difficulty: 4 byte big-endian unsigned integer
+//	nonce:      8 byte big-endian unsigned integer
+//	proposer:   bytes(proposer)
+//
+// where bytes(x) is the length of the UTF-8 string x as a 4 byte big-endian unsigned integer, followed by x.
+// Hashes and roots are included as their hex strings, and the first block has the empty parentHash "". Hash and
+// Signature are not part of the encoding, as they are computed from it.
+//
+// The hash of a header is the SHA3-256 of its encoding, written as 64 lower case hex characters. For example the
+// header at height 1 with timeStamp 1, size 0, difficulty 0, nonce 0 and only empty strings encodes to
+//
+//	01 00000001 0000000000000001 00000000 00000000 00000000 00000000 00000000 0000000000000000 00000000
+//
+// testdata/header_vectors.json lists headers with their encoding and hash, and can be checked against by any
+// client that implements this encoding. Headers with a difficulty of at most 256 bits carry a mined nonce, while the
+// others only test the encoding of large integers. TestHeaderVectors checks this implementation against it.
+
+// HeaderVersion is the version byte the canonical header encoding starts with. It changes whenever the encoding
+// does, so that headers of different versions never share a hash.
+const HeaderVersion uint8 = 1
+
+// Encode returns the canonical encoding of header.
+func (header *Header) Encode() []byte {
+	encoded := []byte{HeaderVersion}
+	encoded = appendUint32(encoded, uint32(header.Height))
+	encoded = appendUint64(encoded, uint64(header.Timestamp))
+	encoded = appendString(encoded, header.ParentHash)
+	encoded = appendString(encoded, header.AcceptRoot)
+	encoded = appendString(encoded, header.ApplyRoot)
+	encoded = appendUint32(encoded, uint32(header.Size))
+	encoded = appendUint32(encoded, header.Difficulty)
+	encoded = appendUint64(encoded, header.Nonce)
+	encoded = appendString(encoded, header.Proposer)
+	return encoded
+}
+
+// ComputeHash hashes the canonical encoding of header. The hash is returned as a hex string.
+func (header *Header) ComputeHash() string {
+	sum := sha3.Sum256(header.Encode())
+	return hex.EncodeToString(sum[:])
+}
+
+// appendUint32 appends n as 4 big-endian bytes to encoded. The result is returned.
+func appendUint32(encoded []byte, n uint32) []byte {
+	var field [4]byte
+	binary.BigEndian.PutUint32(field[:], n)
+	return append(encoded, field[:]...)
+}
+
+// appendUint64 appends n as 8 big-endian bytes to encoded. The result is returned.
+func appendUint64(encoded []byte, n uint64) []byte {
+	var field [8]byte
+	binary.BigEndian.PutUint64(field[:], n)
+	return append(encoded, field[:]...)
+}
+
+// appendString appends the length of str as 4 big-endian bytes followed by str to encoded. The result is returned.
+func appendString(encoded []byte, str string) []byte {
+	return append(appendUint32(encoded, uint32(len(str))), str...)
+}
@@ -0,0 +1,53 @@
+package p2
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+// headerVector is an entry of testdata/header_vectors.json: a header, the hex of its canonical encoding, and its
+// hash in Header.Hash.
+type headerVector struct {
+	Name     string `json:"name"`
+	Header   Header `json:"header"`
+	Encoding string `json:"encoding"`
+}
+
+// TestHeaderVectors checks Encode and ComputeHash against every header in testdata/header_vectors.json, and that
+// every header with a difficulty a hash can meet is mined.
+func TestHeaderVectors(t *testing.T) {
+	body, err := ioutil.ReadFile("testdata/header_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []headerVector
+	if err := json.Unmarshal(body, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("no header vectors")
+	}
+	for _, v := range vectors {
+		if encoding := hex.EncodeToString(v.Header.Encode()); encoding != v.Encoding {
+			t.Errorf("%s: encoding is %s, expected %s", v.Name, encoding, v.Encoding)
+		}
+		if hash := v.Header.ComputeHash(); hash != v.Header.Hash {
+			t.Errorf("%s: hash is %s, expected %s", v.Name, hash, v.Header.Hash)
+		}
+		if v.Header.Difficulty <= 256 && !meetsDifficulty(v.Header.Hash, v.Header.Difficulty) {
+			t.Errorf("%s: hash does not meet difficulty %d", v.Name, v.Header.Difficulty)
+		}
+	}
+}
+
+// TestHeaderEncodingExample checks the example of the encoding spec in header.go.
+func TestHeaderEncodingExample(t *testing.T) {
+	header := Header{Height: 1, Timestamp: 1}
+	expected := "01" + "00000001" + "0000000000000001" + "00000000" + "00000000" + "00000000" + "00000000" +
+		"00000000" + "0000000000000000" + "00000000"
+	if encoding := hex.EncodeToString(header.Encode()); encoding != expected {
+		t.Errorf("encoding is %s, expected %s", encoding, expected)
+	}
+}
@@ -0,0 +1,89 @@
+package p2
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+)
+
+// Validator is a member of the validator set of ProofOfAuthority.
+type Validator struct {
+	ID        string            `json:"id"`
+	PublicKey ed25519.PublicKey `json:"publicKey"`
+}
+
+// ProofOfAuthority is the Consensus of a permissioned chain: only the validators in Validators may produce blocks,
+// taking turns in the order they are listed. The block at height h is proposed by validator (h-1) modulo the
+// number of validators, which signs the hash of the block. A node that is a validator sets ID and PrivateKey to
+// seal its own blocks; other nodes only need Validators.
+type ProofOfAuthority struct {
+	Validators []Validator        `json:"validators"`
+	ID         string             `json:"id"`
+	PrivateKey ed25519.PrivateKey `json:"privateKey"`
+}
+
+// Proposer returns the validator whose turn it is to propose the block at height.
+func (poa *ProofOfAuthority) Proposer(height int32) (Validator, bool) {
+	if len(poa.Validators) == 0 || height < 1 {
+		return Validator{}, false
+	}
+	return poa.Validators[int(height-1)%len(poa.Validators)], true
+}
+
+// Prepare marks block as proposed by this node. Blocks are not mined, so the difficulty is cleared.
+func (poa *ProofOfAuthority) Prepare(bc *BlockChain, block *Block, parent Block) {
+	block.Header.Difficulty = 0
+	block.Header.Nonce = 0
+	block.Header.Proposer = poa.ID
+}
+
+// Seal signs the hash of block. ErrOutOfTurn is returned if it is not the turn of this node at the height of
+// block, and ErrUnsigned if this node has no key.
+func (poa *ProofOfAuthority) Seal(ctx context.Context, block *Block) error {
+	proposer, ok := poa.Proposer(block.Header.Height)
+	if !ok || proposer.ID != poa.ID {
+		return ErrOutOfTurn
+	}
+	if len(poa.PrivateKey) != ed25519.PrivateKeySize {
+		return ErrUnsigned
+	}
+	block.Header.Hash = block.Header.ComputeHash()
+	sum, _ := hex.DecodeString(block.Header.Hash)
+	block.Header.Signature = hex.EncodeToString(ed25519.Sign(poa.PrivateKey, sum))
+	return nil
+}
+
+// Verify checks that block was proposed in turn and that its hash is signed by the key of its proposer.
+func (poa *ProofOfAuthority) Verify(bc *BlockChain, block Block, parent Block) error {
+	if block.Header.Proposer == "" || block.Header.Signature == "" {
+		return blockError(block, ErrUnsigned, "")
+	}
+	proposer, ok := poa.Proposer(block.Header.Height)
+	if !ok || proposer.ID != block.Header.Proposer {
+		return blockError(block, ErrOutOfTurn, "expected "+proposer.ID)
+	}
+	sum, err := hex.DecodeString(block.Header.Hash)
+	if err != nil {
+		return blockError(block, ErrBadHash, "")
+	}
+	signature, err := hex.DecodeString(block.Header.Signature)
+	if err != nil || len(proposer.PublicKey) != ed25519.PublicKeySize ||
+		!ed25519.Verify(proposer.PublicKey, sum, signature) {
+		return blockError(block, ErrBadSignature, "")
+	}
+	return nil
+}
+
+// GenerateValidator creates a new key pair for a validator with the given ID. It returns the Validator to list in
+// Validators and the private key to set as PrivateKey on the node of the validator.
+func GenerateValidator(id string) (Validator, ed25519.PrivateKey, error) {
+	if id == "" {
+		return Validator{}, nil, errors.New("missing validator id")
+	}
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return Validator{}, nil, err
+	}
+	return Validator{id, publicKey}, privateKey, nil
+}
@@ -0,0 +1,103 @@
+package p2
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// testAuthorities returns a ProofOfAuthority for each of the validators "a", "b" and "c", set up for the node of
+// that validator.
+func testAuthorities(t *testing.T) map[string]*ProofOfAuthority {
+	var validators []Validator
+	keys := make(map[string]ed25519.PrivateKey)
+	for _, id := range []string{"a", "b", "c"} {
+		validator, key, err := GenerateValidator(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validators = append(validators, validator)
+		keys[id] = key
+	}
+	nodes := make(map[string]*ProofOfAuthority)
+	for id, key := range keys {
+		nodes[id] = &ProofOfAuthority{Validators: validators, ID: id, PrivateKey: key}
+	}
+	return nodes
+}
+
+// signAs returns block at height 1 claimed by proposer and signed with key, bypassing Seal.
+func signAs(proposer string, key ed25519.PrivateKey) Block {
+	block := Block{}
+	block.NewBlock(1, 100, "", testTrie(), testTrie("a", "1"))
+	block.Header.Difficulty = 0
+	block.Header.Proposer = proposer
+	block.Header.Hash = block.Header.ComputeHash()
+	sum, _ := hex.DecodeString(block.Header.Hash)
+	block.Header.Signature = hex.EncodeToString(ed25519.Sign(key, sum))
+	return block
+}
+
+// TestProofOfAuthoritySeal checks that the validators take turns to seal blocks that every node accepts, and that
+// a validator can not seal out of turn.
+func TestProofOfAuthoritySeal(t *testing.T) {
+	nodes := testAuthorities(t)
+	sealer, follower := NewBlockChain(), NewBlockChain()
+	follower.SetConsensus(nodes["c"])
+	parent := Block{}
+	for height, id := range []string{"a", "b", "c", "a"} {
+		sealer.SetConsensus(nodes[id])
+		block := Block{}
+		block.NewBlock(int32(height+1), int64(100+height), parent.Header.Hash, testTrie(), testTrie())
+		if err := sealer.Seal(context.Background(), &block, parent); err != nil {
+			t.Fatalf("%s at height %d: %v", id, height+1, err)
+		}
+		for _, bc := range []*BlockChain{&sealer, &follower} {
+			if err := bc.Insert(block); err != nil {
+				t.Fatalf("block of %s at height %d: %v", id, height+1, err)
+			}
+		}
+		parent = block
+	}
+
+	sealer.SetConsensus(nodes["a"])
+	block := Block{}
+	block.NewBlock(5, 104, parent.Header.Hash, testTrie(), testTrie())
+	if err := sealer.Seal(context.Background(), &block, parent); !errors.Is(err, ErrOutOfTurn) {
+		t.Errorf("a sealing at height 5: got %v, expected %v", err, ErrOutOfTurn)
+	}
+}
+
+// TestProofOfAuthorityVerify checks that Verify rejects blocks that are unsigned, proposed out of turn or signed by
+// a key that is not the key of their proposer.
+func TestProofOfAuthorityVerify(t *testing.T) {
+	nodes := testAuthorities(t)
+	bc := NewBlockChain()
+	bc.SetConsensus(nodes["c"])
+	_, outsiderKey, err := GenerateValidator("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := signAs("a", nodes["a"].PrivateKey)
+	unsigned.Header.Signature = ""
+	cases := []struct {
+		name     string
+		block    Block
+		expected error
+	}{
+		{"in turn", signAs("a", nodes["a"].PrivateKey), nil},
+		{"unsigned", unsigned, ErrUnsigned},
+		{"out of turn", signAs("b", nodes["b"].PrivateKey), ErrOutOfTurn},
+		{"key of another validator", signAs("a", nodes["b"].PrivateKey), ErrBadSignature},
+		{"key of no validator", signAs("a", outsiderKey), ErrBadSignature},
+		{"unknown proposer", signAs("x", outsiderKey), ErrOutOfTurn},
+	}
+	for _, c := range cases {
+		if err := bc.ValidateBlock(c.block); !errors.Is(err, c.expected) {
+			t.Errorf("%s: got %v, expected %v", c.name, err, c.expected)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package p2
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+)
+
+// Difficulty is the number of leading zero bits the hash of the first blocks must have. It is retargeted every
+// RetargetInterval blocks so that blocks are found about every TargetBlockTime seconds. Every node of a network
+// has to use the same values.
+var Difficulty uint32 = 16
+var RetargetInterval int32 = 10
+var TargetBlockTime int64 = 10
+
+// ProofOfWork is the Consensus where the hash of every block must start with a number of zero bits set by
+// NextDifficulty. Blocks are sealed by mining them.
+type ProofOfWork struct{}
+
+// Prepare sets the difficulty of block: Difficulty at height 1 and NextDifficulty of parent above.
+func (pow ProofOfWork) Prepare(bc *BlockChain, block *Block, parent Block) {
+	block.Header.Difficulty = Difficulty
+	if block.Header.Height > 1 {
+		block.Header.Difficulty = bc.NextDifficulty(parent)
+	}
+}
+
+// Seal mines block.
+func (pow ProofOfWork) Seal(ctx context.Context, block *Block) error {
+	return block.Mine(ctx)
+}
+
+// Verify checks that block has the difficulty Prepare would give it and that its hash meets that difficulty. A
+// difficulty above maxDifficulty is always rejected.
+func (pow ProofOfWork) Verify(bc *BlockChain, block Block, parent Block) error {
+	if block.Header.Difficulty > maxDifficulty {
+		return blockError(block, ErrBadDifficulty, fmt.Sprintf("above %d", maxDifficulty))
+	}
+	expected := Difficulty
+	if block.Header.Height > 1 {
+		expected = bc.NextDifficulty(parent)
+	}
+	if block.Header.Difficulty != expected {
+		return blockError(block, ErrBadDifficulty, fmt.Sprintf("expected %d", expected))
+	}
+	if !meetsDifficulty(block.Header.Hash, block.Header.Difficulty) {
+		return blockError(block, ErrBadWork, "")
+	}
+	return nil
+}
+
+// maxRetargetStep is the most the difficulty may change by at once. Every step doubles or halves the work.
+const maxRetargetStep = 2
+
+// maxDifficulty is the number of bits in a hash. No hash can meet a higher difficulty.
+const maxDifficulty uint32 = 256
+
+// NextDifficulty returns the difficulty required of a block whose parent is parent. It only differs from the
+// difficulty of parent every RetargetInterval blocks, where the time the last RetargetInterval blocks took is
+// compared with TargetBlockTime: every halving of that time adds one bit of difficulty and every doubling removes
+// one, by at most maxRetargetStep bits. The difficulty never rises above maxDifficulty.
+func (bc *BlockChain) NextDifficulty(parent Block) uint32 {
+	difficulty := parent.Header.Difficulty
+	if RetargetInterval < 2 || parent.Header.Height%RetargetInterval != 0 {
+		return difficulty
+	}
+	first := parent
+	for i := int32(1); i < RetargetInterval; i++ {
+		var ok bool
+		first, ok = bc.findBlock(first.Header.Height-1, first.Header.ParentHash)
+		if !ok {
+			return difficulty
+		}
+	}
+	actual := parent.Header.Timestamp - first.Header.Timestamp
+	expected := TargetBlockTime * int64(RetargetInterval-1)
+	if actual < 1 {
+		actual = 1
+	}
+	step := 0
+	for ; step < maxRetargetStep && actual*2 <= expected; step++ {
+		actual *= 2
+	}
+	for ; step > -maxRetargetStep && actual >= expected*2; step-- {
+		actual /= 2
+	}
+	if step < 0 && uint32(-step) > difficulty {
+		return 0
+	}
+	if next := uint32(int(difficulty) + step); next < maxDifficulty {
+		return next
+	}
+	return maxDifficulty
+}
+
+// Mine searches for a Nonce that gives blk a hash with at least Header.Difficulty leading zero bits, and sets the
+// Nonce and the Hash of its header. The search stops early with the error of ctx once ctx is done, for example when
+// a peer has found the next block first.
+func (blk *Block) Mine(ctx context.Context) error {
+	for nonce := uint64(0); ; nonce++ {
+		if nonce%1024 == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+		}
+		blk.Header.Nonce = nonce
+		hash := blk.Header.ComputeHash()
+		if meetsDifficulty(hash, blk.Header.Difficulty) {
+			blk.Header.Hash = hash
+			return nil
+		}
+	}
+}
+
+// meetsDifficulty tests if the hex encoded hash starts with at least difficulty zero bits, that is if it is below
+// the target 2^(256-difficulty).
+func meetsDifficulty(hash string, difficulty uint32) bool {
+	sum, err := hex.DecodeString(hash)
+	if err != nil || int(difficulty) > len(sum)*8 {
+		return false
+	}
+	for _, b := range sum {
+		if difficulty == 0 {
+			return true
+		} else if difficulty < 8 {
+			return b>>(8-difficulty) == 0
+		} else if b != 0 {
+			return false
+		}
+		difficulty -= 8
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package p2
+
+// Reorg describes a change of the canonical chain. The blocks in Removed left the canonical chain, ordered from
+// the old head down, and the blocks in Added joined it, ordered from the lowest height up. Ancestor is the last
+// block the old and the new chain share, or an empty Block if they share none. When the chain simply grows,
+// Removed is empty.
+type Reorg struct {
+	Ancestor Block   `json:"ancestor"`
+	Removed  []Block `json:"removed"`
+	Added    []Block `json:"added"`
+}
+
+// OnReorg registers fn to be called with a Reorg every time the head of the canonical chain changes. fn is called
+// by the goroutine that changed the chain, before the change returns, and must not change the chain itself.
+func (bc *BlockChain) OnReorg(fn func(reorg Reorg)) {
+	bc.reorgHandlers = append(bc.reorgHandlers, fn)
+}
+
+// emitReorg calls the handlers registered with OnReorg if the canonical chain is no longer oldChain, which is
+// the canonical chain from before the change.
+func (bc *BlockChain) emitReorg(oldChain []Block) {
+	if len(bc.reorgHandlers) == 0 {
+		return
+	}
+	newChain := bc.CanonicalChain()
+	common := 0
+	for common < len(oldChain) && common < len(newChain) &&
+		oldChain[common].Header.Hash == newChain[common].Header.Hash {
+		common++
+	}
+	if common == len(oldChain) && common == len(newChain) {
+		return
+	}
+	reorg := Reorg{Added: newChain[common:]}
+	if common > 0 {
+		reorg.Ancestor = newChain[common-1]
+	}
+	for i := len(oldChain) - 1; i >= common; i-- {
+		reorg.Removed = append(reorg.Removed, oldChain[i])
+	}
+	for _, fn := range bc.reorgHandlers {
+		fn(reorg)
+	}
+}
+
+// canonicalIfWatched returns the canonical chain if any handler is registered with OnReorg, so that emitReorg can
+// compare against it after a change.
+func (bc *BlockChain) canonicalIfWatched() []Block {
+	if len(bc.reorgHandlers) == 0 {
+		return nil
+	}
+	return bc.CanonicalChain()
+}
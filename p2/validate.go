@@ -0,0 +1,125 @@
+package p2
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxClockDrift is how far the timestamp of a block may be ahead of the local clock.
+var MaxClockDrift = 2 * time.Minute
+
+// The reasons a block is rejected by ValidateBlock. They are wrapped in a BlockError.
+var (
+	ErrBadHash        = errors.New("hash does not match header")
+	ErrBadDifficulty  = errors.New("difficulty does not match the retarget rule")
+	ErrBadWork        = errors.New("hash does not meet difficulty")
+	ErrBadHeight      = errors.New("height out of range")
+	ErrMissingParent  = errors.New("parent not found")
+	ErrBadTrie        = errors.New("trie does not match its contents")
+	ErrBadSize        = errors.New("size does not match tries")
+	ErrTimestampEarly = errors.New("timestamp before parent")
+	ErrTimestampLate  = errors.New("timestamp too far in the future")
+	ErrDuplicateBlock = errors.New("duplicate block")
+	ErrUnsigned       = errors.New("block is not signed")
+	ErrOutOfTurn      = errors.New("proposer is out of turn")
+	ErrBadSignature   = errors.New("signature does not match proposer")
+)
+
+// BlockError is returned when a block is rejected. It names the block and the reason, which is one of the Err
+// values above.
+type BlockError struct {
+	Hash   string
+	Height int32
+	Err    error
+	Detail string
+}
+
+// Error returns a description of the rejected block.
+func (e *BlockError) Error() string {
+	msg := fmt.Sprintf("block %s at height %d: %v", e.Hash, e.Height, e.Err)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Unwrap returns the reason the block was rejected.
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// blockError builds the BlockError for block.
+func blockError(block Block, err error, detail string) error {
+	return &BlockError{block.Header.Hash, block.Header.Height, err, detail}
+}
+
+// ValidateBlock checks that block can be added to bc. The checks that only need the header run first: the hash is
+// recomputed, and the block must follow a parent in bc, one height up and no earlier than it, with a timestamp no
+// more than MaxClockDrift ahead of the local clock. A block at height 1 has no parent, so its parent hash must be
+// empty. The Consensus of bc then verifies the block, so that blocks without valid work or signature are rejected
+// before any trie is read. Finally both tries are checked against their contents and against the roots and size in
+// the header. A *BlockError is returned for the first check that fails.
+func (bc *BlockChain) ValidateBlock(block Block) error {
+	header := block.Header
+	if header.Height < 1 {
+		return blockError(block, ErrBadHeight, "")
+	}
+	if hash := block.Header.ComputeHash(); header.Hash != hash {
+		return blockError(block, ErrBadHash, "expected "+hash)
+	}
+	if header.Timestamp > time.Now().Add(MaxClockDrift).Unix() {
+		return blockError(block, ErrTimestampLate, "")
+	}
+	for _, v := range bc.Chain[header.Height-1] {
+		if v.Header.Hash == header.Hash {
+			return blockError(block, ErrDuplicateBlock, "")
+		}
+	}
+	parent := Block{}
+	if header.Height == 1 && header.ParentHash != "" {
+		return blockError(block, ErrBadHeight, "block at height 1 has a parent")
+	}
+	if header.Height > 1 {
+		var ok bool
+		parent, ok = bc.findBlock(header.Height-1, header.ParentHash)
+		if !ok {
+			return blockError(block, ErrMissingParent, header.ParentHash)
+		}
+		if header.Height != parent.Header.Height+1 {
+			return blockError(block, ErrBadHeight, fmt.Sprintf("parent is at height %d", parent.Header.Height))
+		}
+		if header.Timestamp < parent.Header.Timestamp {
+			return blockError(block, ErrTimestampEarly, "")
+		}
+	}
+	if err := bc.Consensus().Verify(bc, block, parent); err != nil {
+		if _, ok := err.(*BlockError); !ok {
+			err = blockError(block, err, "")
+		}
+		return err
+	}
+	if header.AcceptRoot != block.AcceptValue.Root || header.ApplyRoot != block.ApplyValue.Root {
+		return blockError(block, ErrBadTrie, "roots do not match header")
+	}
+	if report := block.AcceptValue.Verify(); !report.OK() {
+		return blockError(block, ErrBadTrie, fmt.Sprintf("acceptances: %+v", report))
+	}
+	if report := block.ApplyValue.Verify(); !report.OK() {
+		return blockError(block, ErrBadTrie, fmt.Sprintf("applications: %+v", report))
+	}
+	if size := computeSize(block.AcceptValue, block.ApplyValue); header.Size != size {
+		return blockError(block, ErrBadSize, fmt.Sprintf("expected %d", size))
+	}
+	return nil
+}
+
+// findBlock returns the block with the given hash at height, and whether it was found.
+func (bc *BlockChain) findBlock(height int32, hash string) (Block, bool) {
+	for _, v := range bc.Chain[height-1] {
+		if v.Header.Hash == hash {
+			return v, true
+		}
+	}
+	return Block{}, false
+}
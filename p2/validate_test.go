@@ -0,0 +1,112 @@
+package p2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"../p1"
+)
+
+// testTrie returns a trie holding the given key value pairs.
+func testTrie(pairs ...string) p1.MerklePatriciaTrie {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		mpt.Insert(pairs[i], pairs[i+1])
+	}
+	return mpt
+}
+
+// withDifficulty sets Difficulty for the duration of a test.
+func withDifficulty(t *testing.T, difficulty uint32) {
+	old := Difficulty
+	Difficulty = difficulty
+	t.Cleanup(func() { Difficulty = old })
+}
+
+// TestValidateChecksWorkBeforeTries checks that a block without proof-of-work is rejected for it, and that the
+// tries of a block are only checked once its work is valid.
+func TestValidateChecksWorkBeforeTries(t *testing.T) {
+	withDifficulty(t, 8)
+	bc := NewBlockChain()
+	block := Block{}
+	block.NewBlock(1, 100, "", testTrie(), testTrie("a", "1"))
+	block.ApplyValue.Root = "junk"
+	block.Header.ApplyRoot = "junk"
+	block.Header.Hash = block.Header.ComputeHash()
+	if err := bc.ValidateBlock(block); !errors.Is(err, ErrBadWork) {
+		t.Errorf("unmined block: got %v, expected %v", err, ErrBadWork)
+	}
+	if err := block.Mine(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ValidateBlock(block); !errors.Is(err, ErrBadTrie) {
+		t.Errorf("mined block with a broken trie: got %v, expected %v", err, ErrBadTrie)
+	}
+}
+
+// TestValidateAcceptsMinedBlocks checks that mined blocks are inserted and that a block is rejected once its
+// parent is missing or it is inserted twice.
+func TestValidateAcceptsMinedBlocks(t *testing.T) {
+	withDifficulty(t, 4)
+	bc := NewBlockChain()
+	first := Block{}
+	first.NewBlock(1, 100, "", testTrie(), testTrie("a", "1"))
+	if err := bc.Seal(context.Background(), &first, Block{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Insert(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Insert(first); !errors.Is(err, ErrDuplicateBlock) {
+		t.Errorf("second insert: got %v, expected %v", err, ErrDuplicateBlock)
+	}
+	orphan := Block{}
+	orphan.NewBlock(2, first.Header.Timestamp, "missing", testTrie(), testTrie())
+	if err := bc.Seal(context.Background(), &orphan, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Insert(orphan); !errors.Is(err, ErrMissingParent) {
+		t.Errorf("block without parent: got %v, expected %v", err, ErrMissingParent)
+	}
+}
+
+// TestDifficultyLimit checks that retargeting never raises the difficulty above the bit length of a hash, and that
+// a block with a higher difficulty is rejected for it even if it was configured.
+func TestDifficultyLimit(t *testing.T) {
+	bc := NewBlockChain()
+	parentHash := ""
+	for height := int32(1); height <= RetargetInterval; height++ {
+		hash := string(rune('a' + height))
+		addForkBlock(&bc, height, hash, parentHash, maxDifficulty-1)
+		parentHash = hash
+	}
+	parent := bc.Chain[RetargetInterval-1][0]
+	if next := bc.NextDifficulty(parent); next != maxDifficulty {
+		t.Errorf("fast blocks at difficulty %d retarget to %d, expected %d", maxDifficulty-1, next, maxDifficulty)
+	}
+
+	withDifficulty(t, maxDifficulty+1)
+	block := Block{}
+	block.NewBlock(1, 100, "", testTrie(), testTrie("a", "1"))
+	if err := bc.ValidateBlock(block); !errors.Is(err, ErrBadDifficulty) {
+		t.Errorf("block with difficulty %d: got %v, expected %v", maxDifficulty+1, err, ErrBadDifficulty)
+	}
+}
+
+// TestValidateFirstBlockHasNoParent checks that a block at height 1 is rejected if it names a parent, even if a
+// block with that hash is stored.
+func TestValidateFirstBlockHasNoParent(t *testing.T) {
+	withDifficulty(t, 4)
+	bc := testChain(t, 1)
+	first, _ := bc.Head()
+	block := Block{}
+	block.NewBlock(1, 100, first.Header.Hash, testTrie(), testTrie("a", "1"))
+	if err := bc.Seal(context.Background(), &block, Block{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ValidateBlock(block); !errors.Is(err, ErrBadHeight) {
+		t.Errorf("block at height 1 with a parent: got %v, expected %v", err, ErrBadHeight)
+	}
+}
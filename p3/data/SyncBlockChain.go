@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -13,15 +14,55 @@ import (
 type SyncBlockChain struct {
 	bc  p2.BlockChain
 	mux sync.Mutex
+	// acceptances and merits are derived from the canonical chain and kept up to date on every reorg of bc
+	acceptances map[string]int32
+	merits      []InchainMerit
 }
 
 // NewBlockChain returns a new SyncBlockChain
-func NewBlockChain() SyncBlockChain {
-	return SyncBlockChain{bc: p2.NewBlockChain()}
+func NewBlockChain() *SyncBlockChain {
+	sbc := &SyncBlockChain{bc: p2.NewBlockChain(), acceptances: make(map[string]int32)}
+	sbc.bc.OnReorg(sbc.applyReorg)
+	return sbc
 }
 
-// Get returns the list of blocks at a given height
-func (sbc *SyncBlockChain) Get(height int32) ([]p2.Block, bool) {
+// applyReorg updates the derived indexes after the canonical chain changed. Blocks that only extend the chain are
+// added on top, otherwise the indexes are rebuilt from the new canonical chain so that nothing from the abandoned
+// fork is left behind. It is called by bc while sbc.mux is held.
+func (sbc *SyncBlockChain) applyReorg(reorg p2.Reorg) {
+	added := reorg.Added
+	if len(reorg.Removed) > 0 {
+		sbc.acceptances = make(map[string]int32)
+		sbc.merits = nil
+		added = sbc.bc.CanonicalChain()
+	}
+	for _, blk := range added {
+		for company, uid := range blk.Acceptances() {
+			sbc.acceptances[company] = uid
+		}
+		for _, v := range blk.Applications() {
+			m := InchainMerit{}
+			err := json.Unmarshal([]byte(v), &m)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not add %s\n", v)
+				continue
+			}
+			sbc.merits = append(sbc.merits, m)
+		}
+	}
+}
+
+// OnReorg registers fn to be called with every change of the canonical chain. fn is called while the chain is
+// locked, after the indexes of sbc are updated, and must not call sbc
+func (sbc *SyncBlockChain) OnReorg(fn func(reorg p2.Reorg)) {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	sbc.bc.OnReorg(fn)
+}
+
+// GetForks returns the list of blocks of every fork at a given height. Use CanonicalBlock for the block of the
+// canonical chain
+func (sbc *SyncBlockChain) GetForks(height int32) ([]p2.Block, bool) {
 	if height < 0 {
 		return []p2.Block{}, false
 	}
@@ -30,14 +71,11 @@ func (sbc *SyncBlockChain) Get(height int32) ([]p2.Block, bool) {
 	return sbc.bc.Get(height), true
 }
 
-// GetBlock gets the block with the specific hash at the given height
+// GetBlock gets the block with the specific hash at the given height, on any fork
 func (sbc *SyncBlockChain) GetBlock(height int32, hash string) (p2.Block, bool) {
-	if height < 0 {
-		return p2.Block{}, false
-	}
 	sbc.mux.Lock()
 	defer sbc.mux.Unlock()
-	for _, v := range sbc.bc.Chain[height] {
+	for _, v := range sbc.bc.Get(height) {
 		if v.Header.Hash == hash {
 			return v, true
 		}
@@ -45,31 +83,72 @@ func (sbc *SyncBlockChain) GetBlock(height int32, hash string) (p2.Block, bool)
 	return p2.Block{}, false
 }
 
-// Insert inserts to the blockchain
-func (sbc *SyncBlockChain) Insert(block p2.Block) {
+// Insert inserts to the blockchain. A *p2.BlockError is returned if the block is rejected
+func (sbc *SyncBlockChain) Insert(block p2.Block) error {
 	sbc.mux.Lock()
-	sbc.bc.Insert(block)
 	defer sbc.mux.Unlock()
+	return sbc.bc.Insert(block)
 }
 
-// Length length of SBC
-func (sbc *SyncBlockChain) Length() int32 {
-	fmt.Printf("Length: %v", sbc.bc.Length)
+// MaxHeight returns the height of the highest block on any fork. The canonical chain may end below it, use Head
+// for its last block
+func (sbc *SyncBlockChain) MaxHeight() int32 {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
 	return sbc.bc.Length
 }
 
-// CheckParentHash adds the block if the parent hash exists
-func (sbc *SyncBlockChain) CheckParentHash(insertBlock p2.Block) bool {
+// Head returns the last block of the canonical chain
+func (sbc *SyncBlockChain) Head() (p2.Block, bool) {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.Head()
+}
+
+// CanonicalChain returns the blocks of the canonical chain, from the lowest height up
+func (sbc *SyncBlockChain) CanonicalChain() []p2.Block {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.CanonicalChain()
+}
+
+// CanonicalBlock returns the block of the canonical chain at a given height
+func (sbc *SyncBlockChain) CanonicalBlock(height int32) (p2.Block, bool) {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.CanonicalBlock(height)
+}
+
+// SetConsensus sets the consensus blocks are sealed and validated with
+func (sbc *SyncBlockChain) SetConsensus(consensus p2.Consensus) {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	sbc.bc.SetConsensus(consensus)
+}
+
+// Seal prepares block on top of parent and seals it with the consensus of the chain. The chain is only locked
+// while the block is prepared, so it can be read and updated while the block is mined
+func (sbc *SyncBlockChain) Seal(ctx context.Context, block *p2.Block, parent p2.Block) error {
+	sbc.mux.Lock()
+	consensus := sbc.bc.Consensus()
+	consensus.Prepare(&sbc.bc, block, parent)
+	sbc.mux.Unlock()
+	return consensus.Seal(ctx, block)
+}
+
+// InsertOnKnownParent adds the block if its parent is stored on any fork
+func (sbc *SyncBlockChain) InsertOnKnownParent(insertBlock p2.Block) bool {
 	sbc.mux.Lock()
 	defer sbc.mux.Unlock()
-	return sbc.bc.CheckParentHash(insertBlock)
+	return sbc.bc.InsertOnKnownParent(insertBlock)
 }
 
-// UpdateEntireBlockChain decodes blockChainJson and adds the values to the blockchain
-func (sbc *SyncBlockChain) UpdateEntireBlockChain(blockChainJson string) {
+// UpdateEntireBlockChain decodes blockChainJson and replaces the blockchain with it.
+// An error is returned and the blockchain is kept if any block fails to decode or is rejected by ValidateBlock.
+func (sbc *SyncBlockChain) UpdateEntireBlockChain(blockChainJson string) error {
 	sbc.mux.Lock()
 	defer sbc.mux.Unlock()
-	sbc.bc.DecodeFromJson(blockChainJson)
+	return sbc.bc.DecodeFromJson(blockChainJson)
 }
 
 // BlockChainToJson returns the json for the blockchain
@@ -79,38 +158,38 @@ func (sbc *SyncBlockChain) BlockChainToJson() (string, error) {
 	return sbc.bc.EncodeToJson()
 }
 
-// GenBlock generates a block at the next height
-func (sbc *SyncBlockChain) GenBlock(acceptMpt p1.MerklePatriciaTrie, applyMpt p1.MerklePatriciaTrie) p2.Block {
-	sbc.mux.Lock()
-	defer sbc.mux.Unlock()
-	blk, err := sbc.bc.GenBlock(acceptMpt, applyMpt)
-	if err != nil {
-		return p2.Block{}
+// GenBlock generates the next block on top of the head of the canonical chain, seals it under ctx and inserts it.
+// Like Seal, the chain is not locked while the block is mined. The error of Seal or Insert is returned
+func (sbc *SyncBlockChain) GenBlock(ctx context.Context, acceptMpt p1.MerklePatriciaTrie,
+	applyMpt p1.MerklePatriciaTrie) (p2.Block, error) {
+	parent, _ := sbc.Head()
+	block := p2.Block{}
+	block.Initial(parent.Header.Height+1, parent.Header.Hash, acceptMpt, applyMpt)
+	if err := sbc.Seal(ctx, &block, parent); err != nil {
+		return p2.Block{}, err
+	}
+	if err := sbc.Insert(block); err != nil {
+		return p2.Block{}, err
 	}
-	// TODO: Check error
-	return blk
+	return block, nil
 }
 
+// ShowAcceptances returns the accepted UID of every company on the canonical chain
 func (sbc *SyncBlockChain) ShowAcceptances() map[string]int32 {
 	sbc.mux.Lock()
 	defer sbc.mux.Unlock()
-	return sbc.bc.ShowAcceptances()
+	acc := make(map[string]int32, len(sbc.acceptances))
+	for company, uid := range sbc.acceptances {
+		acc[company] = uid
+	}
+	return acc
 }
 
+// ShowApplications returns the merits on the canonical chain as JSON
 func (sbc *SyncBlockChain) ShowApplications() string {
 	sbc.mux.Lock()
 	defer sbc.mux.Unlock()
-	applications := sbc.bc.ShowApplications()
-	var merits []InchainMerit
-	for _, v := range applications {
-		m := InchainMerit{}
-		err := json.Unmarshal([]byte(v), &m)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not add %s\n", v)
-			continue
-		}
-		merits = append(merits, m)
-	}
+	merits := sbc.merits
 	res, err := json.Marshal(&merits)
 	if err != nil {
 		return ""
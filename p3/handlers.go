@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"sync"
 	"time"
@@ -16,7 +18,7 @@ import (
 )
 
 // Chain
-var SBC data.SyncBlockChain
+var SBC *data.SyncBlockChain
 
 // In memory data structures
 var identityMap map[int32]data.Identity
@@ -37,6 +39,13 @@ func init() {
 
 	// init sbc
 	SBC = data.NewBlockChain()
+	if path := os.Getenv("SAMMICH_POA"); path != "" {
+		poa, err := loadAuthority(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		SBC.SetConsensus(poa)
+	}
 
 	// init data structures
 	identityMap = make(map[int32]data.Identity)
@@ -46,6 +55,7 @@ func init() {
 	// init Caches
 	applicationCache = make(map[int32]data.Merit)
 	acceptanceCache = make(map[string]int32)
+	SBC.OnReorg(restoreCaches)
 	// First 0-99 are reserved for potential testing
 	UID = 99
 
@@ -81,6 +91,10 @@ func GetMerit(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// flushCache2BC mines or signs a block holding the cached applications and acceptances on top of the canonical
+// chain. The caches are only cleared of the included entries once the block is the head of the canonical chain, so
+// nothing is lost if mining is cancelled because a peer's block arrived first, if the block ends up on a side fork,
+// or if it is not this node's turn to sign.
 func flushCache2BC() {
 	acceptMpt := p1.MerklePatriciaTrie{}
 	acceptMpt.Initial()
@@ -88,7 +102,12 @@ func flushCache2BC() {
 	applyMpt.Initial()
 
 	cnt := 0
+	applications := make(map[string]string)
+	acceptances := make(map[string]string)
+	includedApplications := make(map[int32]bool)
+	includedAcceptances := make(map[string]int32)
 
+	cachemux.Lock()
 	for k, v := range applicationCache {
 		inchainMerit := new(data.InchainMerit)
 		inchainMerit.Skills = v.Skills
@@ -99,29 +118,137 @@ func flushCache2BC() {
 		if err != nil {
 			fmt.Print("UNABLE TO FLUSH CACHE TO BC")
 		}
-		applyMpt.Insert(string(k), string(inchainMeritJSON))
-		delete(applicationCache, k)
+		applications[string(p1.Int32Key(k))] = string(inchainMeritJSON)
+		includedApplications[k] = true
 		cnt++
 	}
 
 	for k, v := range acceptanceCache {
-		acceptMpt.Insert(k, strconv.Itoa(int(v)))
-		delete(acceptanceCache, k)
+		acceptances[k] = strconv.Itoa(int(v))
+		includedAcceptances[k] = v
 		cnt++
 	}
+	cachemux.Unlock()
+
+	if cnt == 0 {
+		return
+	}
+
+	// Build each trie in one pass instead of inserting key by key
+	applyMpt.InsertBatch(applications)
+	acceptMpt.InsertBatch(acceptances)
+
+	block := new(p2.Block)
+	parentBlock, ok := SBC.Head()
+	if !ok {
+		block.Initial(1, "", acceptMpt, applyMpt)
+	} else {
+		fmt.Println(parentBlock)
+		block.Initial(parentBlock.Header.Height+1, parentBlock.Header.Hash, acceptMpt, applyMpt)
+	}
+
+	if err := mineBlock(block, parentBlock); err != nil {
+		fmt.Println("Block not sealed:", err)
+		return
+	}
+	if err := SBC.Insert(*block); err != nil {
+		fmt.Println(err)
+		return
+	}
+	// A heavier fork may have arrived while mining, leaving the block on a side fork: keep the entries cached then
+	if head, _ := SBC.Head(); head.Header.Hash != block.Header.Hash {
+		return
+	}
+
+	cachemux.Lock()
+	defer cachemux.Unlock()
+	for k := range includedApplications {
+		delete(applicationCache, k)
+	}
+	for k, v := range includedAcceptances {
+		if acceptanceCache[k] == v {
+			delete(acceptanceCache, k)
+		}
+	}
+}
+
+// restoreCaches puts the applications and acceptances of the blocks a reorg removed from the canonical chain back
+// into the caches, unless the new chain holds them as well, so that they are included in a later block. An
+// acceptance is not restored over a newer one of the same company that is still cached
+func restoreCaches(reorg p2.Reorg) {
+	if len(reorg.Removed) == 0 {
+		return
+	}
+	keptApplications := make(map[int32]bool)
+	keptAcceptances := make(map[string]int32)
+	for _, blk := range reorg.Added {
+		for _, m := range inchainMerits(blk) {
+			keptApplications[m.UID] = true
+		}
+		for company, uid := range blk.Acceptances() {
+			keptAcceptances[company] = uid
+		}
+	}
 
-	if cnt > 0 {
-		block := new(p2.Block)
-		if SBC.Length() == 0 {
-			block.Initial(1, "GENESIS", acceptMpt, applyMpt)
-		} else {
-			parentBlock, _ := SBC.Get(SBC.Length())
-			fmt.Println(parentBlock)
-			block.Initial(SBC.Length()+1, parentBlock[0].Header.Hash, acceptMpt, applyMpt)
+	cachemux.Lock()
+	defer cachemux.Unlock()
+	// Removed is ordered from the old head down, so the latest acceptance of a company is seen first
+	for _, blk := range reorg.Removed {
+		for _, m := range inchainMerits(blk) {
+			if !keptApplications[m.UID] {
+				applicationCache[m.UID] = data.Merit{Skills: m.Skills, Education: m.Education, Experience: m.Experience}
+			}
+		}
+		for company, uid := range blk.Acceptances() {
+			if kept, ok := keptAcceptances[company]; ok && kept == uid {
+				continue
+			}
+			if _, ok := acceptanceCache[company]; !ok {
+				acceptanceCache[company] = uid
+			}
 		}
+	}
+}
+
+// inchainMerits decodes the applications of blk. Applications that cannot be decoded are skipped
+func inchainMerits(blk p2.Block) []data.InchainMerit {
+	var merits []data.InchainMerit
+	for _, v := range blk.Applications() {
+		m := data.InchainMerit{}
+		if err := json.Unmarshal([]byte(v), &m); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not decode %s\n", v)
+			continue
+		}
+		merits = append(merits, m)
+	}
+	return merits
+}
 
-		SBC.Insert(*block)
+// ReceiveBlock inserts a block sent by a peer. The block being mined is cancelled if the head of the canonical chain
+// is no longer its parent, but not for a block on a side fork. A block that is rejected is answered with 400 and the
+// reason
+func ReceiveBlock(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+	block := p2.Block{}
+	if err := block.DecodeFromJson(string(body)); err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err := SBC.Insert(block); err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if head, ok := SBC.Head(); ok {
+		stopMining(head.Header.Hash)
 	}
+	w.WriteHeader(200)
 }
 
 func startTickin() {
@@ -215,6 +342,38 @@ func Accept(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ShowTrie shows the acceptance or application trie of the canonical block at a given height, as an indented tree or,
+// with ?format=dot, as a Graphviz DOT graph
+func ShowTrie(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	height, err := strconv.Atoi(vars["height"])
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	block, ok := SBC.CanonicalBlock(int32(height))
+	if !ok {
+		w.WriteHeader(404)
+		return
+	}
+	var mpt p1.MerklePatriciaTrie
+	switch vars["kind"] {
+	case "acceptances":
+		mpt = block.AcceptValue
+	case "applications":
+		mpt = block.ApplyValue
+	default:
+		w.WriteHeader(404)
+		return
+	}
+	if r.URL.Query().Get("format") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Write([]byte(mpt.Dot()))
+	} else {
+		w.Write([]byte(mpt.Tree()))
+	}
+}
+
 // Show Blockchain
 func Show(w http.ResponseWriter, r *http.Request) {
 	_, err := w.Write([]byte(SBC.Show()))
@@ -237,7 +396,7 @@ func ShowKeys(w http.ResponseWriter, r *http.Request) {
 
 // Download Blockchain
 func Download(w http.ResponseWriter, r *http.Request) {
-	jsonString, err := json.Marshal(&SBC)
+	jsonString, err := json.Marshal(SBC)
 	if err != nil {
 		w.WriteHeader(500)
 	}
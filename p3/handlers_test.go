@@ -0,0 +1,77 @@
+package p3
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"../p1"
+	"../p2"
+	"./data"
+)
+
+// sealedBlock returns a block on top of parent holding the given acceptances and applications, sealed by sbc.
+func sealedBlock(t *testing.T, sbc *data.SyncBlockChain, parent p2.Block, timestamp int64,
+	acceptances map[string]int32, applications []data.InchainMerit) p2.Block {
+	acceptMpt := p1.MerklePatriciaTrie{}
+	acceptMpt.Initial()
+	for company, uid := range acceptances {
+		acceptMpt.Insert(company, strconv.Itoa(int(uid)))
+	}
+	applyMpt := p1.MerklePatriciaTrie{}
+	applyMpt.Initial()
+	for _, m := range applications {
+		merit, _ := json.Marshal(m)
+		applyMpt.Insert(string(p1.Int32Key(m.UID)), string(merit))
+	}
+	block := p2.Block{}
+	block.NewBlock(parent.Header.Height+1, timestamp, parent.Header.Hash, acceptMpt, applyMpt)
+	if err := sbc.Seal(context.Background(), &block, parent); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// TestRestoreCachesOnReorg checks that the entries of a block that a reorg removes from the canonical chain are
+// put back into the caches, unless the new chain holds them too.
+func TestRestoreCachesOnReorg(t *testing.T) {
+	oldDifficulty := p2.Difficulty
+	p2.Difficulty = 0
+	defer func() { p2.Difficulty = oldDifficulty }()
+	cachemux.Lock()
+	applicationCache = make(map[int32]data.Merit)
+	acceptanceCache = map[string]int32{"newer": 9}
+	cachemux.Unlock()
+
+	sbc := data.NewBlockChain()
+	sbc.OnReorg(restoreCaches)
+	genesis := sealedBlock(t, sbc, p2.Block{}, 100, nil, nil)
+	own := sealedBlock(t, sbc, genesis, 110, map[string]int32{"acme": 5, "kept": 6, "newer": 7},
+		[]data.InchainMerit{{UID: 100, Skills: []string{"go"}}, {UID: 101}})
+	fork1 := sealedBlock(t, sbc, genesis, 111, map[string]int32{"kept": 6}, []data.InchainMerit{{UID: 101}})
+	fork2 := sealedBlock(t, sbc, fork1, 120, nil, nil)
+	for _, blk := range []p2.Block{genesis, own, fork1, fork2} {
+		if err := sbc.Insert(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if head, _ := sbc.Head(); head.Header.Hash != fork2.Header.Hash {
+		t.Fatalf("head is %s, expected the longer fork", head.Header.Hash)
+	}
+
+	cachemux.Lock()
+	defer cachemux.Unlock()
+	expected := map[string]int32{"acme": 5, "newer": 9}
+	if len(acceptanceCache) != len(expected) {
+		t.Errorf("acceptance cache is %v, expected %v", acceptanceCache, expected)
+	}
+	for company, uid := range expected {
+		if acceptanceCache[company] != uid {
+			t.Errorf("acceptance cache is %v, expected %v", acceptanceCache, expected)
+		}
+	}
+	if len(applicationCache) != 1 || len(applicationCache[100].Skills) != 1 {
+		t.Errorf("application cache is %v, expected only UID 100", applicationCache)
+	}
+}
@@ -0,0 +1,60 @@
+package p3
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+
+	"../p2"
+)
+
+// The block being mined, if any, and the hash of the parent it is mined on. It can be cancelled once a peer's block
+// moves the head of the canonical chain away from that parent
+var minerMux sync.Mutex
+var cancelMining context.CancelFunc
+var miningParent string
+
+// mineBlock seals block on top of parent with the consensus of the chain: it is mined under proof-of-work and
+// signed under proof-of-authority. An error is returned if mining was cancelled by stopMining or the block could
+// not be sealed.
+func mineBlock(block *p2.Block, parent p2.Block) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	minerMux.Lock()
+	cancelMining = cancel
+	miningParent = parent.Header.Hash
+	minerMux.Unlock()
+
+	err := SBC.Seal(ctx, block, parent)
+
+	minerMux.Lock()
+	cancelMining = nil
+	minerMux.Unlock()
+	cancel()
+	return err
+}
+
+// stopMining cancels the block being mined, if any, unless head is still the parent it is mined on. Once the head
+// of the canonical chain moved, the block would only extend a side fork, whether the new head is above, at or
+// below its height
+func stopMining(head string) {
+	minerMux.Lock()
+	defer minerMux.Unlock()
+	if cancelMining != nil && head != miningParent {
+		cancelMining()
+	}
+}
+
+// loadAuthority reads the proof-of-authority configuration of this node from a JSON file: the list of validators
+// and, if this node is one of them, its ID and private key
+func loadAuthority(path string) (*p2.ProofOfAuthority, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	poa := new(p2.ProofOfAuthority)
+	if err := json.Unmarshal(body, poa); err != nil {
+		return nil, err
+	}
+	return poa, nil
+}
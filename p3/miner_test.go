@@ -0,0 +1,77 @@
+package p3
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"../p2"
+	"./data"
+)
+
+// TestStopMiningOnHeavierFork mines on the head of a long chain and checks that a block on a lighter side fork does
+// not cancel the mining, while a block that makes a heavier fork at a lower height canonical does.
+func TestStopMiningOnHeavierFork(t *testing.T) {
+	oldDifficulty, oldInterval, oldSBC := p2.Difficulty, p2.RetargetInterval, SBC
+	p2.Difficulty, p2.RetargetInterval = 1, 2
+	defer func() { p2.Difficulty, p2.RetargetInterval, SBC = oldDifficulty, oldInterval, oldSBC }()
+
+	// The slow second block of the long chain retargets it to difficulty 0, while the fast second block of the
+	// fork retargets it to difficulty 3, so its third block outweighs both of the lower blocks of the long chain.
+	SBC = data.NewBlockChain()
+	// The difficulty of a block depends on the blocks below it, so they are inserted before it is sealed
+	insert := func(parent p2.Block, timestamp int64) p2.Block {
+		t.Helper()
+		blk := sealedBlock(t, SBC, parent, timestamp, nil, nil)
+		if err := SBC.Insert(blk); err != nil {
+			t.Fatal(err)
+		}
+		return blk
+	}
+	genesis := insert(p2.Block{}, 100)
+	long2 := insert(genesis, 200)
+	long3 := insert(long2, 210)
+	long4 := insert(long3, 220)
+	fork2 := insert(genesis, 101)
+	side2 := sealedBlock(t, SBC, genesis, 150, nil, nil)
+	fork3 := sealedBlock(t, SBC, fork2, 102, nil, nil)
+	if head, _ := SBC.Head(); head.Header.Hash != long4.Header.Hash {
+		t.Fatalf("head is at height %d, expected the long chain", head.Header.Height)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	minerMux.Lock()
+	cancelMining, miningParent = cancel, long4.Header.Hash
+	minerMux.Unlock()
+	defer func() {
+		minerMux.Lock()
+		cancelMining = nil
+		minerMux.Unlock()
+	}()
+
+	receive := func(blk p2.Block) {
+		t.Helper()
+		body, err := blk.EncodeToJson()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		ReceiveBlock(w, httptest.NewRequest("POST", "/block/receive", strings.NewReader(body)))
+		if w.Code != 200 {
+			t.Fatalf("block at height %d answered with %d: %s", blk.Header.Height, w.Code, w.Body)
+		}
+	}
+	receive(side2)
+	if ctx.Err() != nil {
+		t.Fatal("mining was cancelled by a block on a side fork")
+	}
+	receive(fork3)
+	if head, _ := SBC.Head(); head.Header.Hash != fork3.Header.Hash {
+		t.Fatalf("head is at height %d, expected the heavier fork", head.Header.Height)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("mining was not cancelled by a heavier fork at a lower height")
+	}
+}
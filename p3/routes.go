@@ -18,6 +18,12 @@ var routes = Routes{
 		"/apply",
 		Apply,
 	},
+	Route{
+		"ReceiveBlock",
+		"POST",
+		"/block/receive",
+		ReceiveBlock,
+	},
 	Route{
 		"Show",
 		"GET",
@@ -54,6 +60,12 @@ var routes = Routes{
 		"/view/acceptances",
 		FetchAcceptances,
 	},
+	Route{
+		"ShowTrie",
+		"GET",
+		"/view/trie/{height}/{kind}",
+		ShowTrie,
+	},
 	Route{
 		"Download",
 		"GET",